@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+)
+
+const defaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// handlerDeleteAccount deactivates the authenticated user's account. It is
+// deleted for good once the grace period has passed, unless the user logs in
+// again before then.
+func (cfg *apiConfig) handlerDeleteAccount() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		type parameters struct {
+			Password string `json:"password"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserById(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusNotFound, "User not found", err)
+			return
+		}
+		// A stolen access token alone shouldn't be enough to delete an
+		// account.
+		if !cfg.reauthenticate(w, r, dbUser, params.Password) {
+			return
+		}
+		cfg.clearAccountThrottle(r.Context(), dbUser.Email)
+
+		dbUser, err = cfg.db.DeactivateUser(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't delete account", err)
+			return
+		}
+		// Sign out everywhere. Logging in again is how the account is
+		// restored.
+		if err := cfg.db.RevokeAllRefreshTokensForUser(r.Context(), userID); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+			return
+		}
+		if err := cfg.db.RevokeAllPersonalAccessTokensForUser(r.Context(), userID); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke personal access tokens", err)
+			return
+		}
+		cfg.clearSessionCookies(w)
+
+		deleteAt := dbUser.DeactivatedAt.Time.Add(cfg.accountDeletionGracePeriod)
+		cfg.sendMail(mailer.Message{
+			To:      dbUser.Email,
+			Subject: "Your Chirpy account will be deleted",
+			Body: fmt.Sprintf(
+				"Your Chirpy account and everything in it will be deleted on %s.\n\nIf you change your mind, log in before then and your account will be restored.\n",
+				deleteAt.Format(time.RFC1123),
+			),
+		})
+
+		type response struct {
+			DeleteAt time.Time `json:"delete_at"`
+		}
+		respondWithJSON(w, http.StatusAccepted, response{DeleteAt: deleteAt})
+	})
+}
+
+// restoreAccount cancels the deletion of a deactivated account. It's called
+// whenever a user successfully logs in.
+func (cfg *apiConfig) restoreAccount(ctx context.Context, dbUser database.User) error {
+	if !dbUser.DeactivatedAt.Valid {
+		return nil
+	}
+	if err := cfg.db.ReactivateUser(ctx, dbUser.ID); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Restored account", "user_id", dbUser.ID)
+	return nil
+}
+
+// handlerAdminDeleteUser deletes a user right away, skipping the grace
+// period.
+func (cfg *apiConfig) handlerAdminDeleteUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid user ID", err)
+			return
+		}
+
+		var deleted int64
+		err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+			deleted, err = q.DeleteUser(r.Context(), userID)
+			if err != nil || deleted == 0 {
+				return err
+			}
+			_, err = outbox.Write(r.Context(), q, eventUserDeleted, userID, userDeletedEvent{UserID: userID})
+			return err
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't delete user", err)
+			return
+		}
+		if deleted == 0 {
+			respondWithError(w, r, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		logging.FromContext(r.Context()).Info("Deleted user on admin request", "deleted_user_id", userID)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// purgeDeactivatedUsers deletes the accounts whose grace period has ended.
+// Everything else a user owns is removed with them by the database.
+func (cfg *apiConfig) purgeDeactivatedUsers(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-cfg.accountDeletionGracePeriod)
+	var ids []uuid.UUID
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		var err error
+		ids, err = q.PurgeDeactivatedUsers(ctx, sql.NullTime{Time: cutoff, Valid: true})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if _, err := outbox.Write(ctx, q, eventUserDeleted, id, userDeletedEvent{UserID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		slog.Info("Deleted user after the deletion grace period", "user_id", id)
+	}
+	return nil
+}
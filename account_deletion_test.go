@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+
+	email := uuid.NewString() + "@example.com"
+	password := "correct horse battery staple"
+	credentials := map[string]string{"email": email, "password": password}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+	var chirp Chirp
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{
+		"body": "Soon to be gone",
+	}, &chirp); code != http.StatusCreated {
+		t.Fatalf("create chirp status = %d, want %d", code, http.StatusCreated)
+	}
+	chirpURL := chirpy.URL + "/api/chirps/" + chirp.Id.String()
+
+	if code := doJSON(t, http.MethodDelete, chirpy.URL+"/api/users/me", user.Token, map[string]string{
+		"password": "wrong password",
+	}, nil); code != http.StatusUnauthorized {
+		t.Errorf("delete with wrong password status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := doJSON(t, http.MethodDelete, chirpy.URL+"/api/users/me", user.Token, map[string]string{
+		"password": password,
+	}, nil); code != http.StatusAccepted {
+		t.Fatalf("delete status = %d, want %d", code, http.StatusAccepted)
+	}
+
+	// Deactivated accounts are signed out and their chirps are hidden.
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/refresh", user.RefreshToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("refresh after delete status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{"body": "Still here?"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("create chirp after delete status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := doJSON(t, http.MethodGet, chirpy.URL+"/api/users/me", user.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("get account after delete status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := doJSON(t, http.MethodGet, chirpURL, "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("get chirp after delete status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	// Logging in during the grace period restores the account.
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login after delete status = %d, want %d", code, http.StatusOK)
+	}
+	if code := doJSON(t, http.MethodGet, chirpURL, "", nil, nil); code != http.StatusOK {
+		t.Errorf("get chirp after restore status = %d, want %d", code, http.StatusOK)
+	}
+
+	// Accounts past the grace period are purged.
+	if code := doJSON(t, http.MethodDelete, chirpy.URL+"/api/users/me", user.Token, map[string]string{
+		"password": password,
+	}, nil); code != http.StatusAccepted {
+		t.Fatalf("second delete status = %d, want %d", code, http.StatusAccepted)
+	}
+	cfg.accountDeletionGracePeriod = 0
+	if err := cfg.purgeDeactivatedUsers(context.Background()); err != nil {
+		t.Fatalf("purgeDeactivatedUsers() error = %v", err)
+	}
+	if _, err := cfg.db.GetUserById(context.Background(), user.Id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserById() after purge error = %v, want %v", err, sql.ErrNoRows)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, nil); code != http.StatusUnauthorized {
+		t.Errorf("login after purge status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
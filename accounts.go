@@ -1,23 +1,72 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gyulaieric/chirpy/internal/auth"
 	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/entitlements"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/validation"
 )
 
+// refreshTokenRetention is how long refresh tokens are kept after they
+// expire or are revoked, so they still show up in data exports for a while.
+const refreshTokenRetention = 30 * 24 * time.Hour
+
 type User struct {
-	Id           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Id            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+}
+
+// CurrentUser is the signed in user, along with what their plan lets them
+// do so clients can adapt to it.
+type CurrentUser struct {
+	User
+	Entitlements entitlements.Entitlements `json:"entitlements"`
+}
+
+func (cfg *apiConfig) handlerGetCurrentUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserById(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusNotFound, "User not found", err)
+			return
+		}
+		plan, ok := cfg.loadEntitlements(w, r, userID)
+		if !ok {
+			return
+		}
+		respondWithJSON(w, http.StatusOK, CurrentUser{
+			User: User{
+				Id:            dbUser.ID,
+				CreatedAt:     dbUser.CreatedAt,
+				UpdatedAt:     dbUser.UpdatedAt,
+				Email:         dbUser.Email,
+				EmailVerified: dbUser.EmailVerifiedAt.Valid,
+				IsChirpyRed:   dbUser.IsChirpyRed,
+			},
+			Entitlements: plan,
+		})
+	})
 }
 
 func (cfg *apiConfig) handlerRegister() http.Handler {
@@ -31,26 +80,39 @@ func (cfg *apiConfig) handlerRegister() http.Handler {
 		params := parameters{}
 		err := decoder.Decode(&params)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		email, errs := cfg.validateCredentials(params.Email, params.Password)
+		if len(errs) > 0 {
+			respondWithValidationErrors(w, errs)
 			return
 		}
 
 		hashedPassword, err := auth.HashPassword(params.Password)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't hash password", err)
 			return
 		}
 		dbUser, err := cfg.db.CreateUser(
 			r.Context(),
 			database.CreateUserParams{
-				Email:          params.Email,
+				Email:          email,
 				HashedPassword: hashedPassword,
 			},
 		)
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, "An account with this email address already exists", err)
+			return
+		}
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create user", err)
 			return
 		}
+		if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+			logging.FromContext(r.Context()).Error("Couldn't send verification email to new user", "user_id", dbUser.ID, "error", err)
+		}
 		respondWithJSON(w, http.StatusCreated, User{
 			Id:        dbUser.ID,
 			CreatedAt: dbUser.CreatedAt,
@@ -60,80 +122,223 @@ func (cfg *apiConfig) handlerRegister() http.Handler {
 	})
 }
 
+// validateCredentials checks an email and password against the password
+// policy and returns the email in its normalized form.
+func (cfg *apiConfig) validateCredentials(email, password string) (string, validation.Errors) {
+	var errs validation.Errors
+	normalizedEmail, err := validation.NormalizeEmail(email)
+	if err != nil {
+		errs.Add("email", err.Error())
+	}
+	for _, problem := range cfg.passwordPolicy.Validate(password, normalizedEmail) {
+		errs.Add("password", problem)
+	}
+	return normalizedEmail, errs
+}
+
 func (cfg *apiConfig) handlerLogin() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type parameters struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email      string `json:"email"`
+			Password   string `json:"password"`
+			UseCookies bool   `json:"use_cookies"`
 		}
 
 		decoder := json.NewDecoder(r.Body)
 		params := parameters{}
 		err := decoder.Decode(&params)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		ip := cfg.clientIP(r)
+		retryAfter, err := cfg.loginLockout(r.Context(), params.Email, ip)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't check login lockout", err)
+			return
+		}
+		if retryAfter > 0 {
+			cfg.recordLoginFailureForEmail(r, params.Email, loginMethodPassword, loginFailureLockedOut)
+			respondWithLockout(w, r, retryAfter)
 			return
 		}
 
 		dbUser, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+			if err := cfg.recordLoginFailure(r.Context(), params.Email, ip); err != nil {
+				logging.FromContext(r.Context()).Error("Couldn't record failed login", "error", err)
+			}
+			cfg.recordLoginAttempt(r, loginAttempt{
+				email:         params.Email,
+				method:        loginMethodPassword,
+				failureReason: loginFailureInvalidCredentials,
+			})
+			respondWithError(w, r, http.StatusUnauthorized, "Incorrect email or password", err)
 			return
 		}
 
-		match, err := auth.CheckPasswordHash(params.Password, dbUser.HashedPassword)
+		match, needsRehash, err := auth.CheckPasswordHashNeedsRehash(params.Password, dbUser.HashedPassword)
 		if err != nil || !match {
-			respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+			if err := cfg.recordLoginFailure(r.Context(), params.Email, ip); err != nil {
+				logging.FromContext(r.Context()).Error("Couldn't record failed login", "error", err)
+			}
+			cfg.recordLoginAttempt(r, loginAttempt{
+				userID:        uuid.NullUUID{UUID: dbUser.ID, Valid: true},
+				email:         dbUser.Email,
+				method:        loginMethodPassword,
+				failureReason: loginFailureInvalidCredentials,
+			})
+			respondWithError(w, r, http.StatusUnauthorized, "Incorrect email or password", err)
 			return
 		}
+		// Logging in is the only time we see the plain password, so use it
+		// to move the hash onto the current parameters.
+		if needsRehash {
+			cfg.rehashPassword(r.Context(), dbUser.ID, params.Password)
+		}
 
-		token, err := auth.MakeJWT(dbUser.ID, cfg.jwtSecret, time.Hour*time.Duration(1))
+		mfaEnabled, err := cfg.mfaEnabled(r.Context(), dbUser.ID)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't generate JWT", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't check two-factor authentication", err)
 			return
 		}
-
-		refreshToken := auth.MakeRefreshToken()
-		if _, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-			Token:     refreshToken,
-			UserID:    dbUser.ID,
-			ExpiresAt: time.Now().UTC().Add(time.Hour * time.Duration(1440)),
-		}); err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't generate Refresh Token", err)
+		if mfaEnabled {
+			// The throttle is only cleared once the second factor is
+			// verified too, or resending the password would allow guessing
+			// codes without limit.
+			cfg.respondWithMFAChallenge(w, r, dbUser)
 			return
 		}
+		cfg.clearAccountThrottle(r.Context(), dbUser.Email)
 
-		respondWithJSON(w, http.StatusOK, User{
-			Id:           dbUser.ID,
-			CreatedAt:    dbUser.CreatedAt,
-			UpdatedAt:    dbUser.UpdatedAt,
-			Email:        dbUser.Email,
-			Token:        token,
-			RefreshToken: refreshToken,
-			IsChirpyRed:  dbUser.IsChirpyRed,
-		})
+		cfg.respondWithTokens(w, r, dbUser, loginMethodPassword, params.UseCookies)
 	})
 }
 
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't rehash password", "user_id", userID, "error", err)
+		return
+	}
+	if err := cfg.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		logging.FromContext(ctx).Error("Couldn't store rehashed password", "user_id", userID, "error", err)
+	}
+}
+
+// respondWithTokens issues a fresh access and refresh token pair for a user
+// that has fully authenticated, restoring their account if they had deleted
+// it. With useCookies, the tokens are set as cookies for the web app instead
+// of being included in the response.
+func (cfg *apiConfig) respondWithTokens(w http.ResponseWriter, r *http.Request, dbUser database.User, method string, useCookies bool) {
+	user, ok := cfg.issueTokens(w, r, dbUser, method, useCookies)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// issueTokens does the work of respondWithTokens, leaving the response to
+// the caller. It responds with an error and returns false if it fails.
+func (cfg *apiConfig) issueTokens(w http.ResponseWriter, r *http.Request, dbUser database.User, method string, useCookies bool) (User, bool) {
+	if err := cfg.restoreAccount(r.Context(), dbUser); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't restore account", err)
+		return User{}, false
+	}
+
+	accessTokenLifetime := time.Hour
+	if useCookies {
+		accessTokenLifetime = sessionAccessTokenLifetime
+	}
+	token, err := auth.MakeJWT(dbUser.ID, cfg.jwtSecret, accessTokenLifetime)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't generate JWT", err)
+		return User{}, false
+	}
+
+	refreshToken := auth.MakeRefreshToken()
+	if _, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenLifetime),
+	}); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't generate Refresh Token", err)
+		return User{}, false
+	}
+	cfg.recordLoginAttempt(r, loginAttempt{
+		userID:       uuid.NullUUID{UUID: dbUser.ID, Valid: true},
+		email:        dbUser.Email,
+		method:       method,
+		refreshToken: refreshToken,
+	})
+
+	user := User{
+		Id:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		Token:         token,
+		RefreshToken:  refreshToken,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+	}
+	if useCookies {
+		cfg.setSessionCookies(w, token, refreshToken)
+		user.Token = ""
+		user.RefreshToken = ""
+	}
+	return user, true
+}
+
+// requestRefreshToken returns the refresh token from the Authorization
+// header, or from the session cookie, and whether it came from the cookie.
+func requestRefreshToken(r *http.Request) (string, bool, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if errors.Is(err, auth.ErrNoAuthorizationHeader) {
+		token, err = sessionToken(r, refreshTokenCookie)
+		return token, true, err
+	}
+	return token, false, err
+}
+
 func (cfg *apiConfig) handlerRefresh() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+		token, fromCookie, err := requestRefreshToken(r)
+		if errors.Is(err, errInvalidCSRFToken) {
+			respondWithError(w, r, http.StatusForbidden, "Missing or invalid CSRF token", err)
+			return
+		}
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Couldn't get Refresh Token from request headers", err)
+			respondWithError(w, r, http.StatusUnauthorized, "Couldn't get Refresh Token from request headers", err)
 			return
 		}
 		dbUser, err := cfg.db.GetUserFromRefreshToken(r.Context(), token)
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Token doesn't exist or has expired", err)
+			respondWithError(w, r, http.StatusUnauthorized, "Token doesn't exist or has expired", err)
 			return
 		}
 		type payload struct {
 			Token string `json:"token"`
 		}
 
+		if fromCookie {
+			jwt, err := auth.MakeJWT(dbUser.ID, cfg.jwtSecret, sessionAccessTokenLifetime)
+			if err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't generate JWT", err)
+				return
+			}
+			cfg.setAccessTokenCookie(w, jwt)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
 		jwt, err := auth.MakeJWT(dbUser.ID, cfg.jwtSecret, time.Hour*time.Duration(1))
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't generate JWT", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't generate JWT", err)
 			return
 		}
 
@@ -145,29 +350,44 @@ func (cfg *apiConfig) handlerRefresh() http.Handler {
 
 func (cfg *apiConfig) handlerRevoke() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+		token, fromCookie, err := requestRefreshToken(r)
+		if errors.Is(err, errInvalidCSRFToken) {
+			respondWithError(w, r, http.StatusForbidden, "Missing or invalid CSRF token", err)
+			return
+		}
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Couldn't get Refresh Token from request headers", err)
+			respondWithError(w, r, http.StatusUnauthorized, "Couldn't get Refresh Token from request headers", err)
 			return
 		}
 		if err := cfg.db.RevokeRefreshToken(r.Context(), token); err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke token", err)
 			return
 		}
+		if fromCookie {
+			cfg.clearSessionCookies(w)
+		}
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
 
+// purgeRefreshTokens deletes refresh tokens that have been expired or
+// revoked for longer than refreshTokenRetention.
+func (cfg *apiConfig) purgeRefreshTokens(ctx context.Context) error {
+	deleted, err := cfg.db.DeleteStaleRefreshTokens(ctx, time.Now().UTC().Add(-refreshTokenRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Deleted stale refresh tokens", "count", deleted)
+	}
+	return nil
+}
+
 func (cfg *apiConfig) handlerUpdateUsers() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Couldn't get Access Token from request headers", err)
-			return
-		}
-		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Invalid access token", err)
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
 			return
 		}
 
@@ -178,32 +398,54 @@ func (cfg *apiConfig) handlerUpdateUsers() http.Handler {
 
 		decoder := json.NewDecoder(r.Body)
 		params := parameters{}
-		err = decoder.Decode(&params)
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		email, errs := cfg.validateCredentials(params.Email, params.Password)
+		if len(errs) > 0 {
+			respondWithValidationErrors(w, errs)
+			return
+		}
+
+		oldUser, err := cfg.db.GetUserById(r.Context(), userID)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			respondWithError(w, r, http.StatusNotFound, "User not found", err)
 			return
 		}
 
 		hashedPassword, err := auth.HashPassword(params.Password)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't hash password", err)
 			return
 		}
 		dbUser, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-			Email:          params.Email,
+			Email:          email,
 			HashedPassword: hashedPassword,
 			ID:             userID,
 		})
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, "An account with this email address already exists", err)
+			return
+		}
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't update user", err)
 			return
 		}
+		if dbUser.Email != oldUser.Email {
+			if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+				logging.FromContext(r.Context()).Error("Couldn't send verification email", "user_id", dbUser.ID, "error", err)
+			}
+		}
 		respondWithJSON(w, http.StatusOK, User{
-			Id:          dbUser.ID,
-			CreatedAt:   dbUser.CreatedAt,
-			UpdatedAt:   dbUser.UpdatedAt,
-			Email:       dbUser.Email,
-			IsChirpyRed: dbUser.IsChirpyRed,
+			Id:            dbUser.ID,
+			CreatedAt:     dbUser.CreatedAt,
+			UpdatedAt:     dbUser.UpdatedAt,
+			Email:         dbUser.Email,
+			EmailVerified: dbUser.EmailVerifiedAt.Valid,
+			IsChirpyRed:   dbUser.IsChirpyRed,
 		})
 	})
 }
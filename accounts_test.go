@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+)
+
+func TestEmailConflicts(t *testing.T) {
+	chirpy, _ := newTestServer(t)
+	user, credentials := createTestUser(t, chirpy.URL)
+	other, _ := createTestUser(t, chirpy.URL)
+
+	// Emails are compared case-insensitively.
+	upper := map[string]string{"email": strings.ToUpper(credentials["email"]), "password": credentials["password"]}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", upper, nil); code != http.StatusConflict {
+		t.Errorf("sign up with taken email status = %d, want %d", code, http.StatusConflict)
+	}
+	if code := doJSON(t, http.MethodPut, chirpy.URL+"/api/users", other.Token, upper, nil); code != http.StatusConflict {
+		t.Errorf("change to taken email status = %d, want %d", code, http.StatusConflict)
+	}
+
+	changed := map[string]string{"email": uuid.NewString() + "@example.com", "password": credentials["password"]}
+	if code := doJSON(t, http.MethodPut, chirpy.URL+"/api/users", user.Token, changed, nil); code != http.StatusOK {
+		t.Errorf("change to free email status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	user, credentials := createTestUser(t, chirpy.URL)
+
+	// Give the user a hash made with weaker parameters than the current ones.
+	ctx := context.Background()
+	weak := argon2id.Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	oldHash, err := argon2id.CreateHash(credentials["password"], &weak)
+	if err != nil {
+		t.Fatalf("CreateHash() error = %v", err)
+	}
+	if err := cfg.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: user.Id, HashedPassword: oldHash}); err != nil {
+		t.Fatalf("UpdateUserPassword() error = %v", err)
+	}
+
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, nil); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+	dbUser, err := cfg.db.GetUserByEmail(ctx, credentials["email"])
+	if err != nil {
+		t.Fatalf("GetUserByEmail() error = %v", err)
+	}
+	match, needsRehash, err := auth.CheckPasswordHashNeedsRehash(credentials["password"], dbUser.HashedPassword)
+	if dbUser.HashedPassword == oldHash || !match || needsRehash || err != nil {
+		t.Errorf("stored hash %q after login, want the password hashed with the current parameters", dbUser.HashedPassword)
+	}
+}
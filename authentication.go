@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/logging"
+)
+
+var errAccountDeactivated = errors.New("account is deactivated")
+
+// authenticate resolves the principal behind the request's credentials.
+func (cfg *apiConfig) authenticate(r *http.Request) (auth.Principal, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if errors.Is(err, auth.ErrNoAuthorizationHeader) {
+		// Browsers using a cookie session don't send the header.
+		token, err = sessionToken(r, accessTokenCookie)
+		if err != nil {
+			return auth.Principal{}, err
+		}
+		return cfg.authenticateAccessToken(r.Context(), token)
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if auth.IsPersonalAccessToken(token) {
+		return cfg.authenticatePersonalAccessToken(r.Context(), token)
+	}
+	return cfg.authenticateAccessToken(r.Context(), token)
+}
+
+func (cfg *apiConfig) authenticateAccessToken(ctx context.Context, token string) (auth.Principal, error) {
+	accessToken, err := auth.ParseAccessToken(token, cfg.jwtSecret)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if err := cfg.checkUserActive(ctx, accessToken.UserID); err != nil {
+		return auth.Principal{}, err
+	}
+	roles, err := cfg.db.GetUserRoles(ctx, accessToken.UserID)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	principal := auth.Principal{
+		UserID: accessToken.UserID,
+		Roles:  roles,
+		Kind:   auth.TokenKindAccess,
+	}
+	// Tokens issued to OAuth clients are limited to what the user consented to.
+	if accessToken.ClientID != "" {
+		principal.Scopes = accessToken.Scopes
+		principal.Kind = auth.TokenKindOAuth
+	}
+	return principal, nil
+}
+
+// checkUserActive rejects the credentials of users who have deleted their
+// accounts. Their access tokens outlive the deletion, so they are checked on
+// every request.
+func (cfg *apiConfig) checkUserActive(ctx context.Context, userID uuid.UUID) error {
+	active, err := cfg.db.IsUserActive(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !active) {
+		return errAccountDeactivated
+	}
+	return err
+}
+
+func (cfg *apiConfig) authenticatePersonalAccessToken(ctx context.Context, token string) (auth.Principal, error) {
+	pat, err := cfg.db.GetActivePersonalAccessToken(ctx, auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return auth.Principal{}, errors.New("personal access token is invalid, expired or revoked")
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if err := cfg.checkUserActive(ctx, pat.UserID); err != nil {
+		return auth.Principal{}, err
+	}
+	if err := cfg.db.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		return auth.Principal{}, err
+	}
+	roles, err := cfg.db.GetUserRoles(ctx, pat.UserID)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return auth.Principal{
+		UserID: pat.UserID,
+		Roles:  roles,
+		Scopes: pat.Scopes,
+		Kind:   auth.TokenKindPersonalAccessToken,
+	}, nil
+}
+
+// middlewareAuth rejects requests without valid credentials and stores the
+// authenticated principal in the request context.
+func (cfg *apiConfig) middlewareAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r)
+		if errors.Is(err, errInvalidCSRFToken) {
+			respondWithError(w, r, http.StatusForbidden, "Missing or invalid CSRF token", err)
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid or missing access token", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+// contextWithPrincipal adds who made a request to its context, and to
+// everything logged for it.
+func contextWithPrincipal(ctx context.Context, principal auth.Principal) context.Context {
+	return logging.WithUserID(auth.ContextWithPrincipal(ctx, principal), principal.UserID.String())
+}
+
+// middlewareOptionalAuth lets anonymous requests through, but still rejects
+// requests that present invalid credentials.
+func (cfg *apiConfig) middlewareOptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r)
+		if errors.Is(err, auth.ErrNoAuthorizationHeader) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if errors.Is(err, errInvalidCSRFToken) {
+			respondWithError(w, r, http.StatusForbidden, "Missing or invalid CSRF token", err)
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid access token", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+// middlewareRequireRole must be wrapped by middlewareAuth.
+func middlewareRequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+		if !principal.HasRole(role) {
+			respondWithError(w, r, http.StatusForbidden, "You don't have permission to do that", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middlewareRequireScope must be wrapped by middlewareAuth.
+func middlewareRequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+		if !principal.HasScope(scope) {
+			respondMissingScope(w, r, scope)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middlewareOptionalScope lets anonymous requests through, but requires scope
+// of those that present credentials. It must be wrapped by
+// middlewareOptionalAuth.
+func middlewareOptionalScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if ok && !principal.HasScope(scope) {
+			respondMissingScope(w, r, scope)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func respondMissingScope(w http.ResponseWriter, r *http.Request, scope string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+	respondWithError(w, r, http.StatusForbidden, fmt.Sprintf("Token is missing the %s scope", scope), nil)
+}
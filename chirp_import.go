@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/archive"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/entitlements"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+)
+
+// maxImportSize limits uploaded archives. Larger archives can be imported
+// with the import command.
+const maxImportSize = 32 << 20
+
+type ImportFailure struct {
+	// Index is the position of the chirp in the archive, starting at 0.
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+type ImportResult struct {
+	Imported int `json:"imported"`
+	// Skipped counts the chirps imported from an earlier copy of the archive.
+	Skipped int             `json:"skipped"`
+	Failed  []ImportFailure `json:"failed"`
+}
+
+// importChirps adds chirps from an archive to a user's chirps, keeping their
+// timestamps and the replies between them. Chirps that can't be imported are
+// reported in the result rather than stopping the import. Chirps are
+// recorded by their ID in the archive, and skipped if it's imported again.
+func (cfg *apiConfig) importChirps(ctx context.Context, userID uuid.UUID, chirps []archive.Chirp) ImportResult {
+	result := ImportResult{Failed: []ImportFailure{}}
+	plan, err := cfg.entitlementsFor(ctx, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't get entitlements", "user_id", userID, "error", err)
+		plan = entitlements.Free()
+	}
+	fail := func(index int, chirp archive.Chirp, err error) {
+		result.Failed = append(result.Failed, ImportFailure{Index: index, ID: chirp.ID, Error: err.Error()})
+	}
+
+	// Import chirps oldest first, so the chirps they reply to come first.
+	order := make([]int, len(chirps))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return chirps[order[i]].CreatedAt.Before(chirps[order[j]].CreatedAt)
+	})
+
+	// imported maps IDs in the archive to the IDs of the imported chirps.
+	imported := map[string]uuid.UUID{}
+	now := time.Now().UTC()
+	for _, index := range order {
+		chirp := chirps[index]
+		if chirp.Err != nil {
+			fail(index, chirp, chirp.Err)
+			continue
+		}
+		if chirp.ID != "" {
+			previous, err := cfg.db.GetImportedChirp(ctx, database.GetImportedChirpParams{UserID: userID, SourceID: chirp.ID})
+			if err == nil {
+				// Replies are still linked to it, unless it has been deleted.
+				if previous.ChirpID.Valid {
+					imported[chirp.ID] = previous.ChirpID.UUID
+				}
+				result.Skipped++
+				continue
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(ctx).Error("Couldn't get imported chirp", "user_id", userID, "error", err)
+				fail(index, chirp, errors.New("couldn't save chirp"))
+				continue
+			}
+		}
+		if chirp.CreatedAt.After(now) {
+			fail(index, chirp, errors.New("created_at is in the future"))
+			continue
+		}
+		body, err := cleanChirpBody(chirp.Body, plan.MaxChirpLength)
+		if err != nil {
+			fail(index, chirp, err)
+			continue
+		}
+
+		// Replies to chirps that aren't in the archive, such as other
+		// people's, are imported as standalone chirps.
+		var replyToID uuid.NullUUID
+		if parentID, ok := imported[chirp.ReplyToID]; ok && chirp.ReplyToID != "" {
+			replyToID = uuid.NullUUID{UUID: parentID, Valid: true}
+		}
+		dbChirp, err := cfg.importChirp(ctx, chirp.ID, database.ImportChirpParams{
+			CreatedAt: chirp.CreatedAt,
+			Body:      body,
+			UserID:    userID,
+			ReplyToID: replyToID,
+		})
+		if isUniqueViolation(err) {
+			// Another import of the same archive got to it first.
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("Couldn't import chirp", "user_id", userID, "error", err)
+			fail(index, chirp, errors.New("couldn't save chirp"))
+			continue
+		}
+		if chirp.ID != "" {
+			imported[chirp.ID] = dbChirp.ID
+		}
+		result.Imported++
+	}
+
+	sort.Slice(result.Failed, func(i, j int) bool {
+		return result.Failed[i].Index < result.Failed[j].Index
+	})
+	return result
+}
+
+// importChirp saves a chirp, recording that it was imported from sourceID
+// unless the archive gave it no ID.
+func (cfg *apiConfig) importChirp(ctx context.Context, sourceID string, params database.ImportChirpParams) (database.Chirp, error) {
+	var dbChirp database.Chirp
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		var err error
+		dbChirp, err = q.ImportChirp(ctx, params)
+		if err != nil {
+			return err
+		}
+		if _, err := outbox.Write(ctx, q, eventChirpCreated, params.UserID, chirpFromDB(dbChirp)); err != nil {
+			return err
+		}
+		if sourceID == "" {
+			return nil
+		}
+		return q.CreateImportedChirp(ctx, database.CreateImportedChirpParams{
+			UserID:   params.UserID,
+			SourceID: sourceID,
+			ChirpID:  uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+		})
+	})
+	return dbChirp, err
+}
+
+func (cfg *apiConfig) handlerImportChirps() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+		if !cfg.checkCanChirp(w, r, userID) {
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, r, http.StatusRequestEntityTooLarge, "Archive is too large", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't read archive", err)
+			return
+		}
+		chirps, err := archive.Parse(data)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Couldn't read archive: "+err.Error(), err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, cfg.importChirps(r.Context(), userID, chirps))
+	})
+}
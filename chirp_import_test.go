@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/entitlements"
+)
+
+func TestImportChirps(t *testing.T) {
+	chirpy, _ := newTestServer(t)
+
+	email := uuid.NewString() + "@example.com"
+	credentials := map[string]string{"email": email, "password": "correct horse battery staple"}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+
+	tweets := `window.YTD.tweets.part0 = [
+  {"tweet": {"id_str": "3", "created_at": "Wed Oct 10 20:21:00 +0000 2018", "full_text": "` + strings.Repeat("a", entitlements.Free().MaxChirpLength+1) + `"}},
+  {"tweet": {"id_str": "2", "created_at": "Wed Oct 10 20:20:00 +0000 2018", "full_text": "What a kerfuffle", "in_reply_to_status_id_str": "1"}},
+  {"tweet": {"id_str": "1", "created_at": "Wed Oct 10 20:19:24 +0000 2018", "full_text": "Hello"}},
+  {"tweet": {"id_str": "4", "created_at": "Wed Oct 10 20:19:24 +0000 2999", "full_text": "From the future"}}
+]`
+	importTweets := func() ImportResult {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, chirpy.URL+"/api/chirps/import", strings.NewReader(tweets))
+		if err != nil {
+			t.Fatalf("Couldn't create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /api/chirps/import: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("import status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		var result ImportResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+	result := importTweets()
+	if result.Imported != 2 || len(result.Failed) != 2 || result.Failed[0].ID != "3" || result.Failed[1].ID != "4" {
+		t.Errorf("import = %+v, want 2 imported and chirps 3 and 4 failed", result)
+	}
+	// Importing the archive again only retries the chirps that failed.
+	result = importTweets()
+	if result.Imported != 0 || result.Skipped != 2 || len(result.Failed) != 2 {
+		t.Errorf("second import = %+v, want 2 skipped and chirps 3 and 4 failed", result)
+	}
+
+	var chirps []Chirp
+	doJSON(t, http.MethodGet, chirpy.URL+"/api/chirps?author_id="+user.Id.String()+"&sort=asc", "", nil, &chirps)
+	if len(chirps) != 2 {
+		t.Fatalf("user has %d chirps, want 2", len(chirps))
+	}
+	hello, reply := chirps[0], chirps[1]
+	if !hello.CreatedAt.Equal(time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC)) {
+		t.Errorf("created_at = %v, want the tweet's", hello.CreatedAt)
+	}
+	if reply.Body != "What a ****" {
+		t.Errorf("reply body = %q, want it cleaned like any chirp", reply.Body)
+	}
+	if reply.ReplyToID == nil || *reply.ReplyToID != hello.Id {
+		t.Errorf("reply_to_id = %v, want %v", reply.ReplyToID, hello.Id)
+	}
+}
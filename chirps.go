@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"slices"
 	"sort"
@@ -11,14 +13,45 @@ import (
 	"github.com/google/uuid"
 	"github.com/gyulaieric/chirpy/internal/auth"
 	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/entitlements"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+)
+
+var (
+	errChirpTooLong       = errors.New("chirp is too long")
+	errChirpQuotaExceeded = errors.New("hourly chirp limit reached")
 )
 
 type Chirp struct {
-	Id        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	Id        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+}
+
+func chirpFromDB(chirp database.Chirp) Chirp {
+	c := Chirp{
+		Id:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}
+	if chirp.ReplyToID.Valid {
+		c.ReplyToID = &chirp.ReplyToID.UUID
+	}
+	return c
+}
+
+// cleanChirpBody applies the rules every chirp must follow, returning the
+// body to store. maxLength depends on the author's plan.
+func cleanChirpBody(body string, maxLength int) (string, error) {
+	if len(body) > maxLength {
+		return "", errChirpTooLong
+	}
+	return replaceProfanity(body), nil
 }
 
 func (cfg *apiConfig) handlerGetChirps() http.Handler {
@@ -28,18 +61,18 @@ func (cfg *apiConfig) handlerGetChirps() http.Handler {
 		if authorId == "" {
 			dbChirps, err := cfg.db.GetChirps(r.Context())
 			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Couldn't fetch chirps from database", err)
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't fetch chirps from database", err)
 				return
 			}
 			chirpArray = append(chirpArray, dbChirps...)
 		} else {
 			userID, err := uuid.Parse(authorId)
 			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Invalid user id", err)
+				respondWithError(w, r, http.StatusInternalServerError, "Invalid user id", err)
 			}
 			dbChirps, err := cfg.db.GetChirpsByUserId(r.Context(), userID)
 			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Couldn't fetch chirps from database", err)
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't fetch chirps from database", err)
 				return
 			}
 			chirpArray = append(chirpArray, dbChirps...)
@@ -55,13 +88,7 @@ func (cfg *apiConfig) handlerGetChirps() http.Handler {
 		}
 		chirps := []Chirp{}
 		for _, dbChirp := range chirpArray {
-			chirps = append(chirps, Chirp{
-				Id:        dbChirp.ID,
-				CreatedAt: dbChirp.CreatedAt,
-				UpdatedAt: dbChirp.UpdatedAt,
-				Body:      dbChirp.Body,
-				UserID:    dbChirp.UserID,
-			})
+			chirps = append(chirps, chirpFromDB(dbChirp))
 		}
 		respondWithJSON(w, http.StatusOK, chirps)
 	})
@@ -71,38 +98,124 @@ func (cfg *apiConfig) handlerGetChirp() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		chirpId, err := uuid.Parse(r.PathValue("chirpID"))
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't parse UUID from path parameter", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't parse UUID from path parameter", err)
 			return
 		}
 		dbChirp, err := cfg.db.GetChirp(r.Context(), chirpId)
 		if err != nil {
-			respondWithError(w, http.StatusNotFound, "Chirp Not Found", err)
+			respondWithError(w, r, http.StatusNotFound, "Chirp Not Found", err)
 			return
 		}
-		respondWithJSON(w, http.StatusOK, Chirp{
-			Id:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			Body:      dbChirp.Body,
-			UserID:    dbChirp.UserID,
-		})
+		respondWithJSON(w, http.StatusOK, chirpFromDB(dbChirp))
 	})
 }
 
 func (cfg *apiConfig) handlerCreateChirp() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		if !cfg.checkCanChirp(w, r, userID) {
+			return
+		}
+		plan, ok := cfg.loadEntitlements(w, r, userID)
+		if !ok {
+			return
+		}
+
+		type parameters struct {
+			Body string `json:"body"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Couldn't get JWT from request headers", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		body, err := cleanChirpBody(params.Body, plan.MaxChirpLength)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Chirp is too long", err)
+			return
+		}
+		var chirp database.Chirp
+		err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+			// Counting and posting under the lock keeps concurrent posts
+			// from going over the limit together.
+			if err := lockUser(r.Context(), q, "chirps", userID); err != nil {
+				return err
+			}
+			recent, err := q.CountChirpsSince(r.Context(), database.CountChirpsSinceParams{
+				UserID:    userID,
+				CreatedAt: time.Now().UTC().Add(-time.Hour),
+			})
+			if err != nil {
+				return err
+			}
+			if recent >= int64(plan.ChirpsPerHour) {
+				return errChirpQuotaExceeded
+			}
+			chirp, err = q.CreateChirp(
+				r.Context(),
+				database.CreateChirpParams{
+					Body:   body,
+					UserID: userID,
+				},
+			)
+			if err != nil {
+				return err
+			}
+			_, err = outbox.Write(r.Context(), q, eventChirpCreated, userID, chirpFromDB(chirp))
+			return err
+		})
+		if errors.Is(err, errChirpQuotaExceeded) {
+			respondWithError(w, r, http.StatusTooManyRequests, fmt.Sprintf("You can post %d chirps an hour", plan.ChirpsPerHour), nil)
 			return
 		}
-		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Invalid JWT", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create chirp", err)
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, chirpFromDB(chirp))
+	})
+}
+
+// handlerUpdateChirp edits the body of one of the user's chirps, for plans
+// that include editing.
+func (cfg *apiConfig) handlerUpdateChirp() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
 			return
 		}
 
-		const maxChirpLength = 140
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid chirp ID", err)
+			return
+		}
+		dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+		if err != nil {
+			respondWithError(w, r, http.StatusNotFound, "Chirp not found", err)
+			return
+		}
+		if dbChirp.UserID != userID {
+			respondWithError(w, r, http.StatusForbidden, "You can't edit a chirp that was created by someone else", nil)
+			return
+		}
+		if !cfg.checkCanChirp(w, r, userID) {
+			return
+		}
+		plan, ok := cfg.checkEntitlement(w, r, userID, entitlements.FeatureEditChirps)
+		if !ok {
+			return
+		}
 
 		type parameters struct {
 			Body string `json:"body"`
@@ -112,35 +225,53 @@ func (cfg *apiConfig) handlerCreateChirp() http.Handler {
 		params := parameters{}
 		err = decoder.Decode(&params)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
 			return
 		}
 
-		if len(params.Body) > maxChirpLength {
-			respondWithError(w, http.StatusBadRequest, "Chirp is too long", nil)
+		body, err := cleanChirpBody(params.Body, plan.MaxChirpLength)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Chirp is too long", err)
 			return
 		}
-		chirp, err := cfg.db.CreateChirp(
-			r.Context(),
-			database.CreateChirpParams{
-				Body:   replaceProfanity(params.Body),
-				UserID: userID,
-			},
-		)
+		var chirp database.Chirp
+		err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+			chirp, err = q.UpdateChirp(r.Context(), database.UpdateChirpParams{
+				ID:   chirpID,
+				Body: body,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = outbox.Write(r.Context(), q, eventChirpUpdated, userID, chirpFromDB(chirp))
+			return err
+		})
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't update chirp", err)
 			return
 		}
-		respondWithJSON(w, http.StatusCreated, Chirp{
-			Id:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		})
+		respondWithJSON(w, http.StatusOK, chirpFromDB(chirp))
 	})
 }
 
+// checkCanChirp responds with an error and returns false if the user isn't
+// allowed to chirp yet.
+func (cfg *apiConfig) checkCanChirp(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	if !cfg.requireEmailVerification {
+		return true
+	}
+	dbUser, err := cfg.db.GetUserById(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, "User not found", err)
+		return false
+	}
+	if !dbUser.EmailVerifiedAt.Valid {
+		respondWithError(w, r, http.StatusForbidden, "Verify your email address before chirping", nil)
+		return false
+	}
+	return true
+}
+
 func replaceProfanity(chirp string) string {
 	badWords := []string{
 		"kerfuffle",
@@ -158,37 +289,38 @@ func replaceProfanity(chirp string) string {
 
 func (cfg *apiConfig) handlerDeleteChirp() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Couldn't get Access Token from request headers", err)
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
 			return
 		}
 
 		chirpId, err := uuid.Parse(r.PathValue("chirpID"))
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't parse UUID from path parameter", err)
-			return
-		}
-
-		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Invalid access token", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't parse UUID from path parameter", err)
 			return
 		}
 
 		dbChirp, err := cfg.db.GetChirp(r.Context(), chirpId)
 		if err != nil {
-			respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+			respondWithError(w, r, http.StatusNotFound, "Chirp not found", err)
 			return
 		}
 
 		if dbChirp.UserID != userID {
-			respondWithError(w, http.StatusForbidden, "You can't delete a chirp that was created by someone else", err)
+			respondWithError(w, r, http.StatusForbidden, "You can't delete a chirp that was created by someone else", err)
 			return
 		}
 
-		if err = cfg.db.DeleteChirp(r.Context(), chirpId); err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp", err)
+		err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+			if err := q.DeleteChirp(r.Context(), chirpId); err != nil {
+				return err
+			}
+			_, err := outbox.Write(r.Context(), q, eventChirpDeleted, userID, chirpFromDB(dbChirp))
+			return err
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't delete chirp", err)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
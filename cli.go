@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/archive"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/polkasim"
+)
+
+// runCommand runs one of the command line tools, given the arguments after
+// the program name.
+func runCommand(args []string) {
+	switch args[0] {
+	case "import":
+		runImportCommand(args[1:])
+	case "polka-sim":
+		runPolkaSimCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q. Available commands: import, polka-sim\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runImportCommand imports an archive of chirps for a user:
+//
+//	chirpy import -email user@example.com archive.zip
+func runImportCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	email := flags.String("email", "", "email of the user to import chirps for")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: chirpy import -email <email> <archive>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *email == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fatal("Couldn't read archive", "path", flags.Arg(0), "error", err)
+	}
+	chirps, err := archive.Parse(data)
+	if err != nil {
+		fatal("Couldn't read archive", "path", flags.Arg(0), "error", err)
+	}
+
+	db := openDB()
+	cfg := &apiConfig{db: database.New(db), sqlDB: db}
+	ctx := context.Background()
+	dbUser, err := cfg.db.GetUserByEmail(ctx, *email)
+	if err != nil {
+		fatal("Couldn't find user", "email", *email, "error", err)
+	}
+
+	result := cfg.importChirps(ctx, dbUser.ID, chirps)
+	fmt.Printf("Imported %d of %d chirps, skipped %d imported before\n", result.Imported, len(chirps), result.Skipped)
+	for _, failure := range result.Failed {
+		fmt.Fprintf(os.Stderr, "Chirp %d (%s): %s\n", failure.Index, failure.ID, failure.Error)
+	}
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// runPolkaSimCommand sends a running server the webhooks Polka would send
+// for a scenario, authenticated with POLKA_KEY and POLKA_WEBHOOK_SECRET:
+//
+//	chirpy polka-sim -user 3311741c-680c-4546-99f3-fc9efac2036c -scenario lifecycle
+func runPolkaSimCommand(args []string) {
+	flags := flag.NewFlagSet("polka-sim", flag.ExitOnError)
+	baseURL := flags.String("url", "http://localhost:8080", "URL of the Chirpy server")
+	userID := flags.String("user", "", "ID of the user the events are about")
+	scenarioName := flags.String("scenario", "upgrade", "scenario to send")
+	delay := flags.Duration("delay", 0, "time to wait between deliveries")
+	list := flags.Bool("list", false, "list the scenarios and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: chirpy polka-sim -user <user ID> [-scenario <name>] [-url <url>]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *list {
+		for _, s := range polkasim.Scenarios {
+			fmt.Printf("%-16s %s\n", s.Name, s.Description)
+		}
+		return
+	}
+	if *userID == "" || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	scenario, ok := polkasim.FindScenario(*scenarioName)
+	if !ok {
+		fatal("Unknown scenario; see -list", "scenario", *scenarioName)
+	}
+	client := &polkasim.Client{
+		BaseURL: *baseURL,
+		APIKey:  os.Getenv("POLKA_KEY"),
+		Secret:  os.Getenv("POLKA_WEBHOOK_SECRET"),
+	}
+	if client.Secret == "" && scenario.Name == "replay" {
+		fatal("The replay scenario needs POLKA_WEBHOOK_SECRET, as only signed deliveries can be told to be stale")
+	}
+	if client.APIKey == "" && client.Secret == "" {
+		fatal("POLKA_KEY or POLKA_WEBHOOK_SECRET must be set")
+	}
+
+	ctx := context.Background()
+	unexpected := 0
+	for i, d := range scenario.Deliveries(*userID, time.Now()) {
+		if i > 0 {
+			time.Sleep(*delay)
+		}
+		status, err := client.Send(ctx, d)
+		if err != nil {
+			fatal("Couldn't send webhook", "event", d.Event.Event, "error", err)
+		}
+		result := "ok"
+		if status != d.Expect {
+			result = fmt.Sprintf("UNEXPECTED, want %d", d.Expect)
+			unexpected++
+		}
+		fmt.Printf("%-20s %-28s %d %s  (%s)\n", d.Event.Event, d.Event.ID, status, result, d.Description)
+	}
+	if unexpected > 0 {
+		os.Exit(1)
+	}
+}
+
+func openDB() *sql.DB {
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		fatal("DB_URL must be set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		fatal("Couldn't connect to database", "error", err)
+	}
+	return db
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestClientNetwork(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{
+			name: "IPv4",
+			ip:   "203.0.113.77",
+			want: "203.0.113.0/24",
+		},
+		{
+			name: "IPv4-mapped IPv6",
+			ip:   "::ffff:203.0.113.77",
+			want: "203.0.113.0/24",
+		},
+		{
+			name: "IPv6",
+			ip:   "2001:db8:1234:5678::1",
+			want: "2001:db8:1234::/48",
+		},
+		{
+			name: "Not an IP",
+			ip:   "unknown",
+			want: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientNetwork(tt.ip); got != tt.want {
+				t.Errorf("clientNetwork(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/jobs"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+)
+
+const (
+	// dataExportReady is the status of exports that can be downloaded.
+	// The others are "pending" and "failed".
+	dataExportReady = "ready"
+
+	// dataExportBuildTimeout bounds how long an export can stay pending,
+	// retries included, before it is purged.
+	dataExportBuildTimeout = time.Hour
+	dataExportLifetime     = 7 * 24 * time.Hour
+	// Building an archive reads everything a user has, so users can only
+	// ask for one every so often.
+	dataExportMaxPerWindow = 1
+	dataExportWindow       = time.Hour
+	// Download links are short-lived, as anyone who has one can use it.
+	// The one emailed to the user lasts longer, since it may not be read
+	// straight away; a fresh one can be fetched from the API after that.
+	dataExportDownloadLinkLifetime = 15 * time.Minute
+	dataExportEmailLinkLifetime    = 24 * time.Hour
+)
+
+type DataExport struct {
+	Id          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completed_at"`
+	// ExpiresAt and DownloadURL are only set once the export is ready.
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func (cfg *apiConfig) dataExportFromDB(export database.GetDataExportRow) DataExport {
+	dataExport := DataExport{
+		Id:        export.ID,
+		CreatedAt: export.CreatedAt,
+		Status:    export.Status,
+	}
+	if export.CompletedAt.Valid {
+		dataExport.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.Status == dataExportReady {
+		dataExport.ExpiresAt = &export.ExpiresAt
+		dataExport.DownloadURL = cfg.dataExportDownloadURL(export.ID, export.ExpiresAt, dataExportDownloadLinkLifetime)
+	}
+	return dataExport
+}
+
+// dataExportDownloadURL returns a signed link to an export's archive that
+// works for lifetime, or until the archive is deleted at expiresAt.
+func (cfg *apiConfig) dataExportDownloadURL(exportID uuid.UUID, expiresAt time.Time, lifetime time.Duration) string {
+	linkExpires := time.Now().UTC().Add(lifetime)
+	if expiresAt.Before(linkExpires) {
+		linkExpires = expiresAt
+	}
+	return cfg.baseURL + auth.SignURL(cfg.jwtSecret, dataExportDownloadPath(exportID), linkExpires)
+}
+
+func dataExportDownloadPath(exportID uuid.UUID) string {
+	return "/api/exports/" + exportID.String() + "/download"
+}
+
+// handlerRequestDataExport starts building an archive of the authenticated
+// user's data. The user is emailed when it's ready.
+func (cfg *apiConfig) handlerRequestDataExport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		requested, err := cfg.db.CountDataExportsSince(r.Context(), database.CountDataExportsSinceParams{
+			UserID:    userID,
+			CreatedAt: time.Now().UTC().Add(-dataExportWindow),
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create export", err)
+			return
+		}
+		if requested >= dataExportMaxPerWindow {
+			respondWithError(w, r, http.StatusTooManyRequests, "You have already requested an export in the last hour", nil)
+			return
+		}
+
+		export, err := cfg.db.CreateDataExport(r.Context(), database.CreateDataExportParams{
+			UserID:    userID,
+			ExpiresAt: time.Now().UTC().Add(dataExportBuildTimeout),
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create export", err)
+			return
+		}
+		if _, err := dataExportJob.Enqueue(r.Context(), cfg.jobs, dataExportJobArgs{ExportID: export.ID, UserID: userID}, jobs.Options{}); err != nil {
+			cfg.failDataExport(r.Context(), export.ID)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create export", err)
+			return
+		}
+		respondWithJSON(w, http.StatusAccepted, cfg.dataExportFromDB(database.GetDataExportRow(export)))
+	})
+}
+
+func (cfg *apiConfig) handlerGetDataExport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		exportID, err := uuid.Parse(r.PathValue("exportID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Couldn't parse UUID from path parameter", err)
+			return
+		}
+		export, err := cfg.db.GetDataExport(r.Context(), database.GetDataExportParams{
+			ID:     exportID,
+			UserID: userID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Export not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get export", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, cfg.dataExportFromDB(export))
+	})
+}
+
+// handlerDownloadDataExport serves an export archive. The signed URL is what
+// authorizes the download; it's only handed out to the export's owner.
+func (cfg *apiConfig) handlerDownloadDataExport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.VerifySignedURL(cfg.jwtSecret, r.URL); err != nil {
+			respondWithError(w, r, http.StatusForbidden, "Invalid or expired download link", err)
+			return
+		}
+		exportID, err := uuid.Parse(r.PathValue("exportID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Couldn't parse UUID from path parameter", err)
+			return
+		}
+
+		archive, err := cfg.db.GetDataExportArchive(r.Context(), exportID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Export not found or expired", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get export", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(archive)
+	})
+}
+
+// dataExportJob builds an export in the background. Its attempts all fit
+// within dataExportBuildTimeout.
+var dataExportJob = jobs.Kind[dataExportJobArgs]{
+	Name:        "data_export",
+	MaxAttempts: 3,
+	Timeout:     10 * time.Minute,
+}
+
+type dataExportJobArgs struct {
+	ExportID uuid.UUID `json:"export_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// runDataExport builds an export and tells the user how it went. Failed
+// builds are retried, and the user is only told once the last one fails.
+func (cfg *apiConfig) runDataExport(ctx context.Context, args dataExportJobArgs) error {
+	dbUser, err := cfg.db.GetUserById(ctx, args.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The account was deleted, and the export along with it.
+		return nil
+	}
+	if err != nil {
+		return cfg.failDataExportAttempt(ctx, args.ExportID, "", fmt.Errorf("couldn't get user: %w", err))
+	}
+	archive, err := cfg.buildDataExport(ctx, dbUser)
+	if err != nil {
+		return cfg.failDataExportAttempt(ctx, args.ExportID, dbUser.Email, fmt.Errorf("couldn't build export: %w", err))
+	}
+	expiresAt := time.Now().UTC().Add(dataExportLifetime)
+	if err := cfg.db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        args.ExportID,
+		Archive:   archive,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return cfg.failDataExportAttempt(ctx, args.ExportID, dbUser.Email, fmt.Errorf("couldn't save export: %w", err))
+	}
+
+	link := cfg.dataExportDownloadURL(args.ExportID, expiresAt, dataExportEmailLinkLifetime)
+	cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Your Chirpy data export is ready",
+		Body: fmt.Sprintf(
+			"The export of your Chirpy data you asked for is ready. Download it here within the next 24 hours:\n\n%s\n\nAfter that, log in to get a new link. The export will be deleted in 7 days.\n",
+			link,
+		),
+	})
+	return nil
+}
+
+// failDataExportAttempt returns err, after marking the export failed and
+// telling the user, if there is one, when it won't be retried.
+func (cfg *apiConfig) failDataExportAttempt(ctx context.Context, exportID uuid.UUID, email string, err error) error {
+	if !jobs.LastAttempt(ctx) {
+		return err
+	}
+	cfg.failDataExport(ctx, exportID)
+	if email != "" {
+		cfg.sendMail(mailer.Message{
+			To:      email,
+			Subject: "Your Chirpy data export failed",
+			Body:    "Something went wrong while exporting your Chirpy data. Please request a new export.\n",
+		})
+	}
+	return err
+}
+
+func (cfg *apiConfig) failDataExport(ctx context.Context, exportID uuid.UUID) {
+	if err := cfg.db.FailDataExport(ctx, exportID); err != nil {
+		logging.FromContext(ctx).Error("Couldn't mark export failed", "export_id", exportID, "error", err)
+	}
+}
+
+type exportProfile struct {
+	Id            uuid.UUID        `json:"id"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
+	IsChirpyRed   bool             `json:"is_chirpy_red"`
+	Roles         []string         `json:"roles"`
+	Identities    []exportIdentity `json:"identities"`
+}
+
+type exportIdentity struct {
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+type exportSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	// ClientID is set for sessions of OAuth apps.
+	ClientID string `json:"client_id,omitempty"`
+}
+
+var exportChirpsTemplate = template.Must(template.New("chirps").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Chirps by {{.Email}}</title>
+</head>
+<body>
+<h1>Chirps by {{.Email}}</h1>
+{{range .Chirps}}<article>
+<p>{{.Body}}</p>
+<time datetime="{{.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.Format "2 Jan 2006 15:04 MST"}}</time>
+</article>
+{{else}}<p>No chirps yet.</p>
+{{end}}</body>
+</html>
+`))
+
+// buildDataExport returns a ZIP archive of everything Chirpy stores about a
+// user. Secrets such as password hashes and tokens are left out.
+func (cfg *apiConfig) buildDataExport(ctx context.Context, dbUser database.User) ([]byte, error) {
+	roles, err := cfg.db.GetUserRoles(ctx, dbUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get roles: %w", err)
+	}
+	dbIdentities, err := cfg.db.ListUserIdentities(ctx, dbUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get identities: %w", err)
+	}
+	profile := exportProfile{
+		Id:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+		Roles:         append([]string{}, roles...),
+		Identities:    []exportIdentity{},
+	}
+	for _, identity := range dbIdentities {
+		profile.Identities = append(profile.Identities, exportIdentity{
+			Issuer:      identity.Issuer,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+
+	dbChirps, err := cfg.db.GetChirpsByUserId(ctx, dbUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get chirps: %w", err)
+	}
+	chirps := []Chirp{}
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, chirpFromDB(dbChirp))
+	}
+	var chirpsHTML bytes.Buffer
+	if err := exportChirpsTemplate.Execute(&chirpsHTML, struct {
+		Email  string
+		Chirps []Chirp
+	}{dbUser.Email, chirps}); err != nil {
+		return nil, fmt.Errorf("couldn't render chirps: %w", err)
+	}
+
+	dbSessions, err := cfg.db.ListRefreshTokensForUser(ctx, dbUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get sessions: %w", err)
+	}
+	sessions := []exportSession{}
+	for _, dbSession := range dbSessions {
+		session := exportSession{
+			CreatedAt: dbSession.CreatedAt,
+			ExpiresAt: dbSession.ExpiresAt,
+			ClientID:  dbSession.ClientID.String,
+		}
+		if dbSession.RevokedAt.Valid {
+			session.RevokedAt = &dbSession.RevokedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+
+	dbEvents, err := cfg.db.ListLoginEvents(ctx, database.ListLoginEventsParams{
+		UserID: uuid.NullUUID{UUID: dbUser.ID, Valid: true},
+		Limit:  math.MaxInt32,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get login history: %w", err)
+	}
+	loginHistory := []LoginEvent{}
+	for _, dbEvent := range dbEvents {
+		loginHistory = append(loginHistory, loginEventFromDB(dbEvent))
+	}
+
+	dbTokens, err := cfg.db.ListPersonalAccessTokens(ctx, dbUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get personal access tokens: %w", err)
+	}
+	tokens := []PersonalAccessToken{}
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, personalAccessTokenFromDB(dbToken))
+	}
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", profile},
+		{"chirps.json", chirps},
+		{"chirps.html", chirpsHTML.Bytes()},
+		{"sessions.json", sessions},
+		{"login_history.json", loginHistory},
+		{"personal_access_tokens.json", tokens},
+	}
+	for _, file := range files {
+		content, ok := file.content.([]byte)
+		if !ok {
+			content, err = json.MarshalIndent(file.content, "", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("couldn't encode %s: %w", file.name, err)
+			}
+		}
+		f, err := zipWriter.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// purgeExpiredDataExports deletes exports past their lifetime, along with
+// ones that never finished building.
+func (cfg *apiConfig) purgeExpiredDataExports(ctx context.Context) error {
+	deleted, err := cfg.db.DeleteExpiredDataExports(ctx)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Deleted expired data exports", "count", deleted)
+	}
+	return nil
+}
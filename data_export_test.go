@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDataExport(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	mail := make(chanMailer, 10)
+	cfg.mailer = mail
+
+	email := uuid.NewString() + "@example.com"
+	credentials := map[string]string{"email": email, "password": "correct horse battery staple"}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	<-mail // verification email
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{
+		"body": "<b>Mine</b>",
+	}, nil); code != http.StatusCreated {
+		t.Fatalf("create chirp status = %d, want %d", code, http.StatusCreated)
+	}
+
+	var export DataExport
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/users/me/export", user.Token, nil, &export); code != http.StatusAccepted {
+		t.Fatalf("request export status = %d, want %d", code, http.StatusAccepted)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/users/me/export", user.Token, nil, nil); code != http.StatusTooManyRequests {
+		t.Errorf("second request status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// The email links straight to the archive.
+	link := receiveLink(t, mail)
+	if link.Path != dataExportDownloadPath(export.Id) {
+		t.Errorf("email links to %s, want the export's download", link.Path)
+	}
+	resp, err := http.Get(link.String())
+	if err != nil {
+		t.Fatalf("GET emailed link: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("emailed link status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if code := doJSON(t, http.MethodGet, chirpy.URL+"/api/users/me/exports/"+export.Id.String(), user.Token, nil, &export); code != http.StatusOK {
+		t.Fatalf("get export status = %d, want %d", code, http.StatusOK)
+	}
+	if export.Status != dataExportReady || export.DownloadURL == "" {
+		t.Fatalf("export = %+v, want a ready export with a download URL", export)
+	}
+
+	resp, err = http.Get(strings.Replace(export.DownloadURL, "signature=", "signature=x", 1))
+	if err != nil {
+		t.Fatalf("GET download URL: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("download with bad signature status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	resp, err = http.Get(export.DownloadURL)
+	if err != nil {
+		t.Fatalf("GET download URL: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Couldn't read archive: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Couldn't open archive: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Couldn't open %s: %v", f.Name, err)
+		}
+		files[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	var profile exportProfile
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.Email != email {
+		t.Errorf("profile.json = %s, want the user's profile", files["profile.json"])
+	}
+	var chirps []Chirp
+	if err := json.Unmarshal(files["chirps.json"], &chirps); err != nil || len(chirps) != 1 || chirps[0].Body != "<b>Mine</b>" {
+		t.Errorf("chirps.json = %s, want the user's chirp", files["chirps.json"])
+	}
+	if html := string(files["chirps.html"]); !strings.Contains(html, "&lt;b&gt;Mine&lt;/b&gt;") {
+		t.Errorf("chirps.html = %s, want the escaped chirp", html)
+	}
+	for _, name := range []string{"sessions.json", "login_history.json", "personal_access_tokens.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+}
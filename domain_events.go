@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+)
+
+// Domain events are written to the outbox with the changes they describe,
+// and relayed to the subscribers registered below.
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpUpdated = "chirp.updated"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserUpgraded = "user.upgraded"
+	// eventUserDeleted stands in for the deletion of everything the user
+	// owned, which the database removes along with them.
+	eventUserDeleted = "user.deleted"
+
+	// outboxRetention is how long published events are kept.
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// userUpgradedEvent is the payload of user.upgraded events.
+type userUpgradedEvent struct {
+	UserID           uuid.UUID `json:"user_id"`
+	Plan             string    `json:"plan"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+// userDeletedEvent is the payload of user.deleted events.
+type userDeletedEvent struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// registerEventSubscribers sets up what happens when each domain event is
+// relayed.
+func (cfg *apiConfig) registerEventSubscribers() {
+	for _, eventType := range webhookEventTypes {
+		cfg.relay.Subscribe(eventType, outbox.SinkFunc(cfg.queueWebhookDeliveries))
+	}
+}
+
+// purgeOutboxEvents deletes events that were published longer ago than
+// outboxRetention.
+func (cfg *apiConfig) purgeOutboxEvents(ctx context.Context) error {
+	deleted, err := cfg.db.DeletePublishedOutboxEventsBefore(ctx, nullTime(time.Now().UTC().Add(-outboxRetention)))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Deleted published outbox events", "count", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/billing"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+)
+
+func TestDomainEvents(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+
+	credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+
+	var got []outbox.Event
+	deleteAttempts := 0
+	record := outbox.SinkFunc(func(ctx context.Context, event outbox.Event) error {
+		// Events of other tests' users may be relayed too.
+		if event.UserID == user.Id {
+			got = append(got, event)
+		}
+		return nil
+	})
+	cfg.relay.Subscribe(eventChirpCreated, record)
+	cfg.relay.Subscribe(eventChirpUpdated, record)
+	cfg.relay.Subscribe(eventUserUpgraded, record)
+	cfg.relay.Subscribe(eventUserDeleted, record)
+	cfg.relay.Subscribe(eventChirpDeleted, outbox.SinkFunc(func(ctx context.Context, event outbox.Event) error {
+		if event.UserID != user.Id {
+			return nil
+		}
+		deleteAttempts++
+		return errors.New("subscriber is down")
+	}))
+
+	var chirp Chirp
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{"body": "Hello"}, &chirp); code != http.StatusCreated {
+		t.Fatalf("create chirp status = %d, want %d", code, http.StatusCreated)
+	}
+	ctx := context.Background()
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		return applySubscriptionEvent(ctx, q, user.Id, billing.Event{Type: billing.EventUpgraded, At: time.Now().UTC()})
+	})
+	if err != nil {
+		t.Fatalf("applySubscriptionEvent() error = %v", err)
+	}
+	if code := doJSON(t, http.MethodPut, chirpy.URL+"/api/chirps/"+chirp.Id.String(), user.Token, map[string]string{"body": "Hello, world"}, nil); code != http.StatusOK {
+		t.Fatalf("edit chirp status = %d, want %d", code, http.StatusOK)
+	}
+	if code := doJSON(t, http.MethodDelete, chirpy.URL+"/api/chirps/"+chirp.Id.String(), user.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("delete chirp status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	if _, err := cfg.relay.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Type != eventChirpCreated || got[1].Type != eventUserUpgraded || got[2].Type != eventChirpUpdated {
+		t.Fatalf("relayed %+v, want the chirp.created, user.upgraded and chirp.updated events", got)
+	}
+	var created Chirp
+	if err := json.Unmarshal(got[0].Payload, &created); err != nil || created.Id != chirp.Id {
+		t.Errorf("chirp.created payload = %s, want the chirp", got[0].Payload)
+	}
+	var upgraded userUpgradedEvent
+	if err := json.Unmarshal(got[1].Payload, &upgraded); err != nil || upgraded.UserID != user.Id || upgraded.Plan != billing.DefaultPlan {
+		t.Errorf("user.upgraded payload = %s, want the user's plan", got[1].Payload)
+	}
+
+	// Published events aren't relayed again, and failed ones are retried
+	// later rather than right away.
+	if _, err := cfg.relay.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending() error = %v", err)
+	}
+	if len(got) != 3 || deleteAttempts != 1 {
+		t.Errorf("relayed %d events and chirp.deleted %d times, want 3 and 1", len(got), deleteAttempts)
+	}
+
+	// Deleting the user is an event too, which outlives them.
+	if code := serveAdmin(t, cfg.handlerAdminDeleteUser(), http.MethodDelete, "/", map[string]string{"userID": user.Id.String()}, nil); code != http.StatusNoContent {
+		t.Fatalf("delete user status = %d, want %d", code, http.StatusNoContent)
+	}
+	if _, err := cfg.relay.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending() error = %v", err)
+	}
+	if len(got) != 4 || got[3].Type != eventUserDeleted {
+		t.Errorf("relayed %+v, want a user.deleted event last", got)
+	}
+}
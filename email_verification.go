@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+)
+
+const emailVerificationLifetime = 24 * time.Hour
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, dbUser database.User) error {
+	token := auth.MakeSignedToken(cfg.jwtSecret)
+	if err := cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		Email:     dbUser.Email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationLifetime),
+	}); err != nil {
+		return err
+	}
+
+	link := cfg.baseURL + "/api/users/verify?token=" + url.QueryEscape(token)
+	cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf(
+			"Confirm that this is your email address by opening the link below:\n\n%s\n\nThe link expires in 24 hours. If you didn't sign up for Chirpy, you can ignore this email.\n",
+			link,
+		),
+	})
+	return nil
+}
+
+func (cfg *apiConfig) handlerVerifyEmail() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if !auth.ValidSignedToken(cfg.jwtSecret, token) {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid or expired verification link", nil)
+			return
+		}
+
+		verification, err := cfg.db.UseEmailVerificationToken(r.Context(), auth.HashToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid or expired verification link", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't verify email", err)
+			return
+		}
+
+		rows, err := cfg.db.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+			ID:    verification.UserID,
+			Email: verification.Email,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't verify email", err)
+			return
+		}
+		if rows == 0 {
+			respondWithError(w, r, http.StatusConflict, "Email address has changed since the link was sent", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (cfg *apiConfig) handlerResendVerification() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserById(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusNotFound, "User not found", err)
+			return
+		}
+		if dbUser.EmailVerifiedAt.Valid {
+			respondWithError(w, r, http.StatusConflict, "Email is already verified", nil)
+			return
+		}
+
+		if err := cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't send verification email", err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/entitlements"
+)
+
+// entitlementsFor returns what a user's subscription entitles them to. They
+// follow the subscription itself rather than is_chirpy_red, so perks end
+// the moment a period does, not when expireSubscriptions next runs.
+func (cfg *apiConfig) entitlementsFor(ctx context.Context, userID uuid.UUID) (entitlements.Entitlements, error) {
+	dbSub, err := cfg.db.GetLatestSubscription(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entitlements.Free(), nil
+	}
+	if err != nil {
+		return entitlements.Entitlements{}, err
+	}
+	if !subscriptionFromDB(dbSub).Entitled(time.Now().UTC()) {
+		return entitlements.Free(), nil
+	}
+	return entitlements.For(dbSub.Plan), nil
+}
+
+// loadEntitlements returns the user's entitlements, or responds with an
+// error and returns false if they can't be loaded.
+func (cfg *apiConfig) loadEntitlements(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (entitlements.Entitlements, bool) {
+	e, err := cfg.entitlementsFor(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't get entitlements", err)
+		return entitlements.Entitlements{}, false
+	}
+	return e, true
+}
+
+// checkEntitlement returns the user's entitlements, or responds with an
+// error and returns false if they don't include feature.
+func (cfg *apiConfig) checkEntitlement(w http.ResponseWriter, r *http.Request, userID uuid.UUID, feature entitlements.Feature) (entitlements.Entitlements, bool) {
+	e, ok := cfg.loadEntitlements(w, r, userID)
+	if !ok {
+		return entitlements.Entitlements{}, false
+	}
+	if !e.Has(feature) {
+		respondWithError(w, r, http.StatusForbidden, "Your plan doesn't include "+string(feature), nil)
+		return entitlements.Entitlements{}, false
+	}
+	return e, true
+}
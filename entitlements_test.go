@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/entitlements"
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+func TestChirpyRedEntitlements(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	cfg.polkaWebhookSecret = "test-webhook-secret"
+
+	credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+
+	var me CurrentUser
+	if code := doJSON(t, http.MethodGet, chirpy.URL+"/api/users/me", user.Token, nil, &me); code != http.StatusOK {
+		t.Fatalf("GET /api/users/me status = %d, want %d", code, http.StatusOK)
+	}
+	if me.Id != user.Id || me.Entitlements.Plan != entitlements.PlanFree || me.Entitlements.Has(entitlements.FeatureEditChirps) {
+		t.Errorf("me = %+v, want the user on the free plan", me)
+	}
+
+	long := strings.Repeat("a", entitlements.Free().MaxChirpLength+1)
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{"body": long}, nil); code != http.StatusBadRequest {
+		t.Errorf("long chirp on the free plan status = %d, want %d", code, http.StatusBadRequest)
+	}
+	var chirp Chirp
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{"body": "Hello"}, &chirp); code != http.StatusCreated {
+		t.Fatalf("create chirp status = %d, want %d", code, http.StatusCreated)
+	}
+	if code := doJSON(t, http.MethodPut, chirpy.URL+"/api/chirps/"+chirp.Id.String(), user.Token, map[string]string{"body": "Hello, world"}, nil); code != http.StatusForbidden {
+		t.Errorf("edit on the free plan status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"id":    uuid.NewString(),
+		"event": "user.upgraded",
+		"data":  map[string]string{"user_id": user.Id.String(), "plan": "chirpy_red"},
+	})
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), body), body); code != http.StatusNoContent {
+		t.Fatalf("upgrade webhook status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	doJSON(t, http.MethodGet, chirpy.URL+"/api/users/me", user.Token, nil, &me)
+	if me.Entitlements.Plan != "chirpy_red" || !me.Entitlements.Has(entitlements.FeatureEditChirps) {
+		t.Errorf("entitlements = %+v, want Chirpy Red's", me.Entitlements)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{"body": long}, nil); code != http.StatusCreated {
+		t.Errorf("long chirp on Chirpy Red status = %d, want %d", code, http.StatusCreated)
+	}
+	var edited Chirp
+	if code := doJSON(t, http.MethodPut, chirpy.URL+"/api/chirps/"+chirp.Id.String(), user.Token, map[string]string{"body": "Hello, world"}, &edited); code != http.StatusOK {
+		t.Fatalf("edit on Chirpy Red status = %d, want %d", code, http.StatusOK)
+	}
+	if edited.Body != "Hello, world" || !edited.UpdatedAt.After(edited.CreatedAt) {
+		t.Errorf("edited chirp = %+v, want the new body and a later updated_at", edited)
+	}
+}
+
+func TestChirpsPerHourLimit(t *testing.T) {
+	chirpy, _ := newTestServer(t)
+	user, _ := createTestUser(t, chirpy.URL)
+
+	// Posting all at once mustn't get more chirps past the limit.
+	limit := entitlements.Free().ChirpsPerHour
+	const extra = 5
+	codes := make(chan int, limit+extra)
+	var wg sync.WaitGroup
+	for range limit + extra {
+		wg.Go(func() {
+			codes <- doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", user.Token, map[string]string{"body": "Hello"}, nil)
+		})
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusCreated] != limit || counts[http.StatusTooManyRequests] != extra {
+		t.Errorf("responses = %v, want %d created and %d too many requests", counts, limit, extra)
+	}
+}
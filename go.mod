@@ -12,6 +12,6 @@ require github.com/golang-jwt/jwt/v5 v5.3.0
 
 require (
 	github.com/alexedwards/argon2id v1.0.0
-	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/crypto v0.14.0
 	golang.org/x/sys v0.13.0 // indirect
 )
@@ -1,61 +1,179 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/billing"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/webhook"
 )
 
+const (
+	maxPolkaWebhookSize = 1 << 20
+	// polkaEventRetention is how long processed event IDs are remembered.
+	// It needs to outlast Polka's retries, since older deliveries fail the
+	// timestamp check anyway, and the logged deliveries an admin can
+	// replay.
+	polkaEventRetention = webhookEventRetention
+)
+
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID string `json:"user_id"`
+		Plan   string `json:"plan"`
+		// CurrentPeriodEnd is when the period paid for ends, if Polka says.
+		CurrentPeriodEnd time.Time `json:"current_period_end"`
+	} `json:"data"`
+}
+
+// authenticatePolkaWebhook checks that a webhook comes from Polka, by its
+// signature if a webhook secret is configured and by its API key otherwise.
+func (cfg *apiConfig) authenticatePolkaWebhook(r *http.Request, body []byte) error {
+	if cfg.polkaWebhookSecret != "" {
+		return webhook.Verify(cfg.polkaWebhookSecret, r.Header.Get("Polka-Signature"), body, cfg.polkaWebhookTolerance)
+	}
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		return errors.New("invalid Polka API key")
+	}
+	return nil
+}
+
 func (cfg *apiConfig) handlerPolkaWebhooks() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		apiKey, err := auth.GetAPIKey(r.Header)
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPolkaWebhookSize))
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Couldn't get API Key from request headers", err)
+			respondWithError(w, r, http.StatusBadRequest, "Couldn't read request body", err)
 			return
 		}
-
-		if apiKey != cfg.polkaKey {
-			respondWithError(w, http.StatusUnauthorized, "Invalid Polka API key", err)
+		if err := cfg.authenticatePolkaWebhook(r, body); err != nil {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid Polka webhook credentials", err)
 			return
 		}
 
-		type parameters struct {
-			Event string `json:"event"`
-			Data  struct {
-				UserID string `json:"user_id"`
-			} `json:"data"`
-		}
-
-		decoder := json.NewDecoder(r.Body)
-		params := parameters{}
-		err = decoder.Decode(&params)
+		logged, err := cfg.recordWebhookEvent(r.Context(), webhookSourcePolka, r.Header, body)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't record webhook", err)
 			return
 		}
-		if params.Event != "user.upgraded" {
-			w.WriteHeader(http.StatusNoContent)
+		outcome := cfg.processPolkaEvent(r.Context(), logged.ID, body, logged.CreatedAt)
+		cfg.setWebhookEventOutcome(r.Context(), logged.ID, outcome)
+
+		if outcome.status == webhookEventFailed {
+			respondWithError(w, r, outcome.httpStatus, outcome.message, outcome.err)
 			return
 		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// errPolkaEventFailed rolls back a Polka event that couldn't be applied.
+var errPolkaEventFailed = errors.New("polka event failed")
 
-		userID, err := uuid.Parse(params.Data.UserID)
+// processPolkaEvent applies delivery, a Polka event received at receivedAt,
+// unless the event has already been processed. The event is recorded as
+// processed in the same transaction that applies it, so a failure or crash in
+// between leaves it unrecorded, and Polka's retry of it is processed.
+func (cfg *apiConfig) processPolkaEvent(ctx context.Context, delivery uuid.UUID, body []byte, receivedAt time.Time) webhookOutcome {
+	event := polkaEvent{}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return webhookFailure(http.StatusInternalServerError, "Couldn't decode parameters", err)
+	}
+	// Signed deliveries must say which event they are, or replays of them
+	// within the tolerance window couldn't be told apart.
+	if event.ID == "" && cfg.polkaWebhookSecret != "" {
+		return webhookFailure(http.StatusBadRequest, "Event ID is required", nil)
+	}
+
+	// Deliveries authenticated by API key may lack an event ID. They can't be
+	// told apart from Polka's retries, but are still claimed by delivery, so
+	// replaying one can't apply it twice.
+	key := event.ID
+	if key == "" {
+		key = "delivery:" + delivery.String()
+	}
+
+	var outcome webhookOutcome
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		// A concurrent delivery of the event waits here until this
+		// transaction ends.
+		claimed, err := q.RecordPolkaEvent(ctx, database.RecordPolkaEventParams{
+			ID:    key,
+			Event: event.Event,
+		})
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't parse user UUID", err)
-			return
+			return err
 		}
-
-		if _, err = cfg.db.GetUserById(r.Context(), userID); err != nil {
-			respondWithError(w, http.StatusNotFound, "User not found", err)
-			return
+		if claimed == 0 {
+			// Already processed; acknowledge it so Polka stops retrying.
+			outcome = webhookOutcome{status: webhookEventDuplicate}
+			return nil
 		}
-
-		if err = cfg.db.UpgradeUser(r.Context(), userID); err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't upgrade user to Chirpy Red", err)
-			return
+		outcome = applyPolkaEvent(ctx, q, event, receivedAt)
+		if outcome.status == webhookEventFailed {
+			return errPolkaEventFailed
 		}
-		w.WriteHeader(http.StatusNoContent)
+		return nil
 	})
+	if err != nil && !errors.Is(err, errPolkaEventFailed) {
+		return webhookFailure(http.StatusInternalServerError, "Couldn't record event", err)
+	}
+	return outcome
+}
+
+// applyPolkaEvent acts on an event, making its changes with q. Subscription
+// periods are reckoned from receivedAt, so replaying a delivery later has
+// the effect it would have had then.
+func applyPolkaEvent(ctx context.Context, q *database.Queries, event polkaEvent, receivedAt time.Time) webhookOutcome {
+	if !billing.IsEvent(event.Event) {
+		return webhookOutcome{status: webhookEventIgnored}
+	}
+
+	userID, err := uuid.Parse(event.Data.UserID)
+	if err != nil {
+		return webhookFailure(http.StatusInternalServerError, "Couldn't parse user UUID", err)
+	}
+	if _, err := q.GetUserById(ctx, userID); err != nil {
+		return webhookFailure(http.StatusNotFound, "User not found", err)
+	}
+	err = applySubscriptionEvent(ctx, q, userID, billing.Event{
+		Type:      event.Event,
+		Plan:      event.Data.Plan,
+		PeriodEnd: event.Data.CurrentPeriodEnd,
+		At:        receivedAt.UTC(),
+	})
+	if errors.Is(err, billing.ErrNoSubscription) {
+		// Nothing to downgrade or refund; the user already lacks Chirpy Red.
+		return webhookOutcome{status: webhookEventIgnored, err: err}
+	}
+	if err != nil {
+		return webhookFailure(http.StatusInternalServerError, "Couldn't update subscription", err)
+	}
+	return webhookOutcome{status: webhookEventProcessed}
+}
+
+// purgePolkaEvents forgets events processed longer ago than Polka retries.
+func (cfg *apiConfig) purgePolkaEvents(ctx context.Context) error {
+	deleted, err := cfg.db.DeletePolkaEventsBefore(ctx, time.Now().UTC().Add(-polkaEventRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Deleted processed Polka events", "count", deleted)
+	}
+	return nil
 }
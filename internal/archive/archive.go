@@ -0,0 +1,210 @@
+// Package archive reads the chirp archives users can import.
+//
+// Two formats are accepted, either on their own or in a ZIP archive:
+//
+//   - Chirpy's chirps.json, as found in data exports: a JSON array of
+//     objects with "id", "created_at" (RFC 3339), "body" and optionally
+//     "reply_to_id". A ZIP must contain it as chirps.json.
+//   - Twitter's tweets.js, as found in Twitter archives: a JavaScript
+//     assignment of an array of tweets, using "id_str", "created_at",
+//     "full_text" and "in_reply_to_status_id_str". A ZIP may contain it
+//     anywhere, and may split it into tweets-part1.js and so on.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"time"
+)
+
+// Limits on ZIP archives, so small archives can't expand into huge ones.
+const (
+	// MaxFileSize limits how much is read from each file.
+	MaxFileSize = 64 << 20
+	// MaxTotalSize limits how much is read from all the files together.
+	MaxTotalSize = 256 << 20
+	// MaxEntries limits how many entries an archive may have. Twitter
+	// archives hold a file for each attached image, so this is generous.
+	MaxEntries = 100_000
+)
+
+var (
+	ErrUnknownFormat   = errors.New("not a Chirpy or Twitter archive")
+	ErrFileTooLarge    = errors.New("archive file is too large")
+	ErrArchiveTooLarge = errors.New("archive is too large")
+	ErrTooManyEntries  = errors.New("archive has too many entries")
+)
+
+var tweetsFilePattern = regexp.MustCompile(`^tweets?(-part\d+)?\.js$`)
+
+// Chirp is a chirp read from an archive. IDs are the ones the archive uses,
+// which need not be UUIDs.
+type Chirp struct {
+	ID        string
+	CreatedAt time.Time
+	Body      string
+	ReplyToID string
+	// Err is set when the chirp couldn't be read, in which case the other
+	// fields may be incomplete.
+	Err error
+}
+
+// Parse reads the chirps in an archive, in the order the archive has them.
+func Parse(data []byte) ([]Chirp, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return parseZip(data)
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return parseChirps(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("window.YTD.")):
+		return parseTweets(trimmed)
+	}
+	return nil, ErrUnknownFormat
+}
+
+func parseZip(data []byte) ([]Chirp, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read ZIP archive: %w", err)
+	}
+	if len(reader.File) > MaxEntries {
+		return nil, ErrTooManyEntries
+	}
+
+	var chirps []Chirp
+	found := false
+	// remaining is how much more may be read from the archive's files.
+	remaining := int64(MaxTotalSize)
+	for _, f := range reader.File {
+		name := path.Base(f.Name)
+		isChirps := f.Name == "chirps.json"
+		if !isChirps && !tweetsFilePattern.MatchString(name) {
+			continue
+		}
+		content, err := readZipFile(f, remaining)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= int64(len(content))
+		var fileChirps []Chirp
+		if isChirps {
+			fileChirps, err = parseChirps(content)
+		} else {
+			fileChirps, err = parseTweets(content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		chirps = append(chirps, fileChirps...)
+		found = true
+	}
+	if !found {
+		return nil, ErrUnknownFormat
+	}
+	return chirps, nil
+}
+
+// readZipFile reads a file, failing if it's larger than MaxFileSize or than
+// remaining, the part of MaxTotalSize left.
+func readZipFile(f *zip.File, remaining int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	limit := min(int64(MaxFileSize), remaining)
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", f.Name, err)
+	}
+	switch {
+	case len(content) > MaxFileSize:
+		return nil, fmt.Errorf("%s: %w", f.Name, ErrFileTooLarge)
+	case int64(len(content)) > remaining:
+		return nil, fmt.Errorf("%s: %w", f.Name, ErrArchiveTooLarge)
+	}
+	return content, nil
+}
+
+func parseChirps(data []byte) ([]Chirp, error) {
+	var items []struct {
+		ID        string `json:"id"`
+		CreatedAt string `json:"created_at"`
+		Body      string `json:"body"`
+		ReplyToID string `json:"reply_to_id"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("couldn't decode chirps: %w", err)
+	}
+
+	chirps := make([]Chirp, 0, len(items))
+	for _, item := range items {
+		chirp := Chirp{
+			ID:        item.ID,
+			Body:      item.Body,
+			ReplyToID: item.ReplyToID,
+		}
+		chirp.CreatedAt, chirp.Err = parseTime(time.RFC3339, item.CreatedAt)
+		chirps = append(chirps, chirp)
+	}
+	return chirps, nil
+}
+
+func parseTweets(data []byte) ([]Chirp, error) {
+	// Strip the "window.YTD.tweets.part0 = " in front of the JSON.
+	start := bytes.IndexByte(data, '[')
+	if start < 0 {
+		return nil, errors.New("no tweets found")
+	}
+	type tweet struct {
+		IDStr                string `json:"id_str"`
+		CreatedAt            string `json:"created_at"`
+		FullText             string `json:"full_text"`
+		InReplyToStatusIDStr string `json:"in_reply_to_status_id_str"`
+	}
+	// Newer archives wrap each tweet in an object of its own.
+	var items []struct {
+		tweet
+		Tweet *tweet `json:"tweet"`
+	}
+	if err := json.Unmarshal(data[start:], &items); err != nil {
+		return nil, fmt.Errorf("couldn't decode tweets: %w", err)
+	}
+
+	chirps := make([]Chirp, 0, len(items))
+	for _, item := range items {
+		t := item.tweet
+		if item.Tweet != nil {
+			t = *item.Tweet
+		}
+		chirp := Chirp{
+			ID: t.IDStr,
+			// Twitter escapes &, < and > in tweet text.
+			Body:      html.UnescapeString(t.FullText),
+			ReplyToID: t.InReplyToStatusIDStr,
+		}
+		chirp.CreatedAt, chirp.Err = parseTime(time.RubyDate, t.CreatedAt)
+		chirps = append(chirps, chirp)
+	}
+	return chirps, nil
+}
+
+func parseTime(layout, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("missing created_at")
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid created_at %q", value)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,205 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const chirpsJSON = `[
+  {
+    "id": "0b6d8f34-6a4c-4bd4-9f5d-0d3f9d3e1a57",
+    "created_at": "2026-01-17T16:51:40.212611Z",
+    "updated_at": "2026-01-17T16:51:40.212611Z",
+    "body": "Hello",
+    "user_id": "f713a4b7-551a-4083-9a9f-def33afe508d"
+  },
+  {
+    "id": "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f",
+    "created_at": "yesterday",
+    "body": "Hello to you too",
+    "reply_to_id": "0b6d8f34-6a4c-4bd4-9f5d-0d3f9d3e1a57"
+  }
+]`
+
+const tweetsJS = `window.YTD.tweets.part0 = [
+  {
+    "tweet" : {
+      "id_str" : "1050118621198921728",
+      "created_at" : "Wed Oct 10 20:19:24 +0000 2018",
+      "full_text" : "Salt &amp; pepper"
+    }
+  },
+  {
+    "tweet" : {
+      "id_str" : "1050118621198921729",
+      "created_at" : "Wed Oct 10 20:20:00 +0000 2018",
+      "full_text" : "@me indeed",
+      "in_reply_to_status_id_str" : "1050118621198921728"
+    }
+  }
+]`
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Couldn't create %s: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Couldn't close archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []Chirp
+		wantErr error
+	}{
+		{
+			name: "Chirpy JSON",
+			data: []byte(chirpsJSON),
+			want: []Chirp{
+				{
+					ID:        "0b6d8f34-6a4c-4bd4-9f5d-0d3f9d3e1a57",
+					CreatedAt: time.Date(2026, 1, 17, 16, 51, 40, 212611000, time.UTC),
+					Body:      "Hello",
+				},
+				{
+					ID:        "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f",
+					Body:      "Hello to you too",
+					ReplyToID: "0b6d8f34-6a4c-4bd4-9f5d-0d3f9d3e1a57",
+					Err:       errors.New(`invalid created_at "yesterday"`),
+				},
+			},
+		},
+		{
+			name: "Twitter archive",
+			data: zipArchive(t, map[string]string{
+				"data/tweets.js":  tweetsJS,
+				"data/account.js": "window.YTD.account.part0 = []",
+			}),
+			want: []Chirp{
+				{
+					ID:        "1050118621198921728",
+					CreatedAt: time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC),
+					Body:      "Salt & pepper",
+				},
+				{
+					ID:        "1050118621198921729",
+					CreatedAt: time.Date(2018, 10, 10, 20, 20, 0, 0, time.UTC),
+					Body:      "@me indeed",
+					ReplyToID: "1050118621198921728",
+				},
+			},
+		},
+		{
+			name: "Chirpy export",
+			data: zipArchive(t, map[string]string{
+				"profile.json": "{}",
+				"chirps.json":  `[{"id": "1", "created_at": "2026-01-17T16:51:40Z", "body": "Hi"}]`,
+			}),
+			want: []Chirp{
+				{
+					ID:        "1",
+					CreatedAt: time.Date(2026, 1, 17, 16, 51, 40, 0, time.UTC),
+					Body:      "Hi",
+				},
+			},
+		},
+		{
+			name:    "ZIP without chirps",
+			data:    zipArchive(t, map[string]string{"profile.json": "{}"}),
+			wantErr: ErrUnknownFormat,
+		},
+		{
+			name:    "Unknown format",
+			data:    []byte("id,body\n1,Hello\n"),
+			wantErr: ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse() returned %d chirps, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.ID != w.ID || !g.CreatedAt.Equal(w.CreatedAt) || g.Body != w.Body || g.ReplyToID != w.ReplyToID {
+					t.Errorf("Parse()[%d] = %+v, want %+v", i, g, w)
+				}
+				if (g.Err == nil) != (w.Err == nil) || (g.Err != nil && g.Err.Error() != w.Err.Error()) {
+					t.Errorf("Parse()[%d].Err = %v, want %v", i, g.Err, w.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRejectsLargeFiles(t *testing.T) {
+	data := zipArchive(t, map[string]string{
+		"chirps.json": "[" + string(bytes.Repeat([]byte(" "), MaxFileSize)) + "]",
+	})
+	if _, err := Parse(data); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Parse() error = %v, wantErr %v", err, ErrFileTooLarge)
+	}
+}
+
+func TestParseRejectsLargeArchives(t *testing.T) {
+	// Each file is within MaxFileSize, but together they are more than
+	// MaxTotalSize. Spaces compress well, so the archive itself is small.
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	spaces := bytes.Repeat([]byte(" "), 1<<20)
+	for i := range MaxTotalSize/MaxFileSize + 1 {
+		f, err := w.Create(fmt.Sprintf("data/tweets-part%d.js", i))
+		if err != nil {
+			t.Fatalf("Couldn't create file: %v", err)
+		}
+		f.Write([]byte("["))
+		for range MaxFileSize>>20 - 1 {
+			f.Write(spaces)
+		}
+		f.Write([]byte("]"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Couldn't close archive: %v", err)
+	}
+
+	if _, err := Parse(buf.Bytes()); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("Parse() error = %v, wantErr %v", err, ErrArchiveTooLarge)
+	}
+}
+
+func TestParseRejectsManyEntries(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i := range MaxEntries + 1 {
+		if _, err := w.Create(fmt.Sprintf("data/tweets_media/%d.jpg", i)); err != nil {
+			t.Fatalf("Couldn't create file: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Couldn't close archive: %v", err)
+	}
+
+	if _, err := Parse(buf.Bytes()); !errors.Is(err, ErrTooManyEntries) {
+		t.Errorf("Parse() error = %v, wantErr %v", err, ErrTooManyEntries)
+	}
+}
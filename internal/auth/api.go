@@ -1,15 +1,32 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 )
 
+var ErrNoAuthorizationHeader = errors.New(`no "Authorization" header included`)
+
 func GetAPIKey(headers http.Header) (string, error) {
+	return getAuthorizationCredentials(headers, "ApiKey")
+}
+
+// getAuthorizationCredentials parses an "Authorization: <scheme> <credentials>"
+// header, rejecting any other scheme and credentials that contain whitespace.
+func getAuthorizationCredentials(headers http.Header, scheme string) (string, error) {
 	authorizationHeader := headers.Get("Authorization")
 	if authorizationHeader == "" {
-		return "", fmt.Errorf(`invalid "Authorization" Header`)
+		return "", ErrNoAuthorizationHeader
+	}
+	gotScheme, credentials, found := strings.Cut(authorizationHeader, " ")
+	if !found || !strings.EqualFold(gotScheme, scheme) {
+		return "", fmt.Errorf(`invalid "Authorization" Header: expected %s scheme`, scheme)
+	}
+	credentials = strings.TrimSpace(credentials)
+	if credentials == "" || strings.ContainsAny(credentials, " \t") {
+		return "", fmt.Errorf(`invalid "Authorization" Header: malformed %s credentials`, scheme)
 	}
-	return strings.Replace(authorizationHeader, "ApiKey ", "", 1), nil
+	return credentials, nil
 }
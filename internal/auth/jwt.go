@@ -10,31 +10,119 @@ import (
 	"github.com/google/uuid"
 )
 
+// Audiences keep tokens issued for one purpose from being accepted for
+// another, e.g. an MFA challenge token being used as an access token.
+const (
+	audienceAccess = "chirpy-access"
+	audienceMFA    = "chirpy-mfa"
+)
+
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.RegisteredClaims{
+	return makeJWT(userID, tokenSecret, expiresIn, audienceAccess)
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return validateJWT(tokenString, tokenSecret, audienceAccess)
+}
+
+// MakeMFAToken issues the short-lived token a user trades, together with a
+// second factor, for real access and refresh tokens.
+func MakeMFAToken(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, tokenSecret, expiresIn, audienceMFA)
+}
+
+func ValidateMFAToken(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return validateJWT(tokenString, tokenSecret, audienceMFA)
+}
+
+// AccessToken is what a validated access token says about its bearer.
+type AccessToken struct {
+	UserID uuid.UUID
+	// ClientID is set for tokens issued to OAuth clients, whose Scopes
+	// limit what the token may be used for.
+	ClientID string
+	Scopes   []string
+}
+
+// MakeScopedJWT issues an access token on behalf of an OAuth client that is
+// only valid for the given scopes.
+func MakeScopedJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, clientID string, scopes []string) (string, error) {
+	return signJWT(newClaims(userID, expiresIn, audienceAccess, clientID, strings.Join(scopes, " ")), tokenSecret)
+}
+
+// ParseAccessToken validates an access token and returns its claims.
+func ParseAccessToken(tokenString, tokenSecret string) (AccessToken, error) {
+	claims, err := parseJWT(tokenString, tokenSecret, audienceAccess)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return AccessToken{}, fmt.Errorf("invalid user ID: %w", err)
+	}
+	accessToken := AccessToken{
+		UserID:   userID,
+		ClientID: claims.ClientID,
+	}
+	if claims.ClientID != "" {
+		accessToken.Scopes = append([]string{}, strings.Fields(claims.Scope)...)
+	}
+	return accessToken, nil
+}
+
+type chirpyClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id,omitempty"`
+	// Scope is a space separated list, as in RFC 8693.
+	Scope string `json:"scope,omitempty"`
+}
+
+func newClaims(userID uuid.UUID, expiresIn time.Duration, audience, clientID, scope string) chirpyClaims {
+	return chirpyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{audience},
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 			Subject:   userID.String(),
 		},
-	)
-	return token.SignedString([]byte(tokenSecret))
+		ClientID: clientID,
+		Scope:    scope,
+	}
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	})
+func signJWT(claims chirpyClaims, tokenSecret string) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(tokenSecret))
+}
+
+func makeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, audience string) (string, error) {
+	return signJWT(newClaims(userID, expiresIn, audience, "", ""), tokenSecret)
+}
+
+func parseJWT(tokenString, tokenSecret, audience string) (*chirpyClaims, error) {
+	claims := &chirpyClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(t *jwt.Token) (any, error) {
+			return []byte(tokenSecret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer("chirpy"),
+		jwt.WithAudience(audience),
+	)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
-	stringUserID, err := token.Claims.GetSubject()
+	return claims, nil
+}
+
+func validateJWT(tokenString, tokenSecret, audience string) (uuid.UUID, error) {
+	claims, err := parseJWT(tokenString, tokenSecret, audience)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	id, err := uuid.Parse(stringUserID)
+	id, err := uuid.Parse(claims.Subject)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
 	}
@@ -42,9 +130,5 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
-	authorizationHeader := headers.Get("Authorization")
-	if authorizationHeader == "" {
-		return "", fmt.Errorf(`invalid "Authorization" Header`)
-	}
-	return strings.Replace(authorizationHeader, "Bearer ", "", 1), nil
+	return getAuthorizationCredentials(headers, "Bearer")
 }
@@ -3,6 +3,7 @@ package auth
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"testing"
 	"time"
 
@@ -66,3 +67,116 @@ func TestGetBearerToken(t *testing.T) {
 		t.Errorf("GetBearerToken() gotToken = %s, want %s", token, tokenString)
 	}
 }
+
+func TestGetBearerTokenMalformed(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		wantToken     string
+		wantErr       bool
+	}{
+		{
+			name:          "Lowercase scheme",
+			authorization: "bearer abc",
+			wantToken:     "abc",
+			wantErr:       false,
+		},
+		{
+			name:          "Missing header",
+			authorization: "",
+			wantErr:       true,
+		},
+		{
+			name:          "Basic scheme",
+			authorization: "Basic xyz",
+			wantErr:       true,
+		},
+		{
+			name:          "Raw token",
+			authorization: "abc",
+			wantErr:       true,
+		},
+		{
+			name:          "Empty credentials",
+			authorization: "Bearer ",
+			wantErr:       true,
+		},
+		{
+			name:          "Extra fields",
+			authorization: "Bearer abc def",
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tt.authorization != "" {
+				headers.Set("Authorization", tt.authorization)
+			}
+			token, err := GetBearerToken(headers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetBearerToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if token != tt.wantToken {
+				t.Errorf("GetBearerToken() gotToken = %s, want %s", token, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestMFATokenNotAcceptedAsAccessToken(t *testing.T) {
+	mfaToken, _ := MakeMFAToken(uuid.New(), "secret", time.Minute)
+	if _, err := ValidateJWT(mfaToken, "secret"); err == nil {
+		t.Errorf("ValidateJWT() accepted an MFA challenge token")
+	}
+}
+
+func TestParseAccessTokenScopes(t *testing.T) {
+	userID := uuid.New()
+	firstParty, _ := MakeJWT(userID, "secret", time.Hour)
+	scoped, _ := MakeScopedJWT(userID, "secret", time.Hour, "client", []string{ScopeChirpsRead})
+	unscoped, _ := MakeScopedJWT(userID, "secret", time.Hour, "client", nil)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantClient string
+		wantScopes []string
+	}{
+		{
+			name:       "First-party token is unrestricted",
+			token:      firstParty,
+			wantClient: "",
+			wantScopes: nil,
+		},
+		{
+			name:       "Client token carries its scopes",
+			token:      scoped,
+			wantClient: "client",
+			wantScopes: []string{ScopeChirpsRead},
+		},
+		{
+			name:       "Client token without scopes is not unrestricted",
+			token:      unscoped,
+			wantClient: "client",
+			wantScopes: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessToken, err := ParseAccessToken(tt.token, "secret")
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			if accessToken.UserID != userID || accessToken.ClientID != tt.wantClient {
+				t.Errorf("ParseAccessToken() = %+v, want user %v and client %q", accessToken, userID, tt.wantClient)
+			}
+			if (accessToken.Scopes == nil) != (tt.wantScopes == nil) || !slices.Equal(accessToken.Scopes, tt.wantScopes) {
+				t.Errorf("ParseAccessToken() scopes = %#v, want %#v", accessToken.Scopes, tt.wantScopes)
+			}
+		})
+	}
+}
@@ -1,9 +1,24 @@
 package auth
 
-import "github.com/alexedwards/argon2id"
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/alexedwards/argon2id"
+	"golang.org/x/crypto/argon2"
+)
+
+// passwordParams are the argon2id parameters new hashes are created with.
+var passwordParams = *argon2id.DefaultParams
+
+// SetPasswordParams changes the argon2id parameters used for new hashes. It
+// is not safe to call concurrently with hashing, so call it during startup.
+func SetPasswordParams(params argon2id.Params) {
+	passwordParams = params
+}
 
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	hashedPassword, err := argon2id.CreateHash(password, &passwordParams)
 	if err != nil {
 		return "", err
 	}
@@ -11,9 +26,35 @@ func HashPassword(password string) (string, error) {
 }
 
 func CheckPasswordHash(password, hash string) (bool, error) {
-	match, _, err := argon2id.CheckHash(password, hash)
+	match, _, err := CheckPasswordHashNeedsRehash(password, hash)
+	return match, err
+}
+
+// CheckPasswordHashNeedsRehash is like CheckPasswordHash, but also reports
+// whether hash was created with parameters other than the current ones, in
+// which case the password should be hashed again and stored.
+func CheckPasswordHashNeedsRehash(password, hash string) (match bool, needsRehash bool, err error) {
+	match, params, err := argon2id.CheckHash(password, hash)
 	if err != nil {
-		return match, err
+		return match, false, err
 	}
-	return match, nil
+	return match, *params != passwordParams, nil
+}
+
+// PasswordHashFormat returns the prefix and length that every hash created
+// with the current parameters has, so that hashes with outdated parameters
+// can be counted without decoding each one.
+func PasswordHashFormat() (prefix string, length int) {
+	prefix = fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$",
+		argon2.Version,
+		passwordParams.Memory,
+		passwordParams.Iterations,
+		passwordParams.Parallelism,
+	)
+	length = len(prefix) +
+		base64.RawStdEncoding.EncodedLen(int(passwordParams.SaltLength)) +
+		len("$") +
+		base64.RawStdEncoding.EncodedLen(int(passwordParams.KeyLength))
+	return prefix, length
 }
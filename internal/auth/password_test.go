@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/alexedwards/argon2id"
 )
 
 func TestCheckPasswordHash(t *testing.T) {
@@ -67,3 +70,76 @@ func TestCheckPasswordHash(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckPasswordHashNeedsRehash(t *testing.T) {
+	original := passwordParams
+	t.Cleanup(func() { SetPasswordParams(original) })
+
+	password := "correctPassword123!"
+	weak := argon2id.Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	strong := argon2id.Params{Memory: 16 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	SetPasswordParams(weak)
+	legacyHash, _ := HashPassword(password)
+	SetPasswordParams(strong)
+	currentHash, _ := HashPassword(password)
+
+	tests := []struct {
+		name            string
+		password        string
+		hash            string
+		wantMatch       bool
+		wantNeedsRehash bool
+	}{
+		{
+			name:            "Hash with legacy parameters",
+			password:        password,
+			hash:            legacyHash,
+			wantMatch:       true,
+			wantNeedsRehash: true,
+		},
+		{
+			name:            "Hash with current parameters",
+			password:        password,
+			hash:            currentHash,
+			wantMatch:       true,
+			wantNeedsRehash: false,
+		},
+		{
+			name:            "Wrong password",
+			password:        "wrongPassword",
+			hash:            legacyHash,
+			wantMatch:       false,
+			wantNeedsRehash: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, needsRehash, err := CheckPasswordHashNeedsRehash(tt.password, tt.hash)
+			if err != nil {
+				t.Fatalf("CheckPasswordHashNeedsRehash() error = %v", err)
+			}
+			if match != tt.wantMatch {
+				t.Errorf("CheckPasswordHashNeedsRehash() match = %v, want %v", match, tt.wantMatch)
+			}
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("CheckPasswordHashNeedsRehash() needsRehash = %v, want %v", needsRehash, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestPasswordHashFormat(t *testing.T) {
+	hash, err := HashPassword("correctPassword123!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	prefix, length := PasswordHashFormat()
+	if !strings.HasPrefix(hash, prefix) {
+		t.Errorf("hash %s doesn't start with %s", hash, prefix)
+	}
+	if len(hash) != length {
+		t.Errorf("len(hash) = %d, want %d", len(hash), length)
+	}
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// codeVerifierPattern is the code_verifier syntax from RFC 7636 section 4.1.
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// MakePKCEVerifier returns a random code verifier, as used by OAuth clients.
+func MakePKCEVerifier() string {
+	verifierBytes := make([]byte, 32)
+	rand.Read(verifierBytes)
+	return base64.RawURLEncoding.EncodeToString(verifierBytes)
+}
+
+// PKCEChallenge returns the S256 code challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks an S256 code challenge against the code verifier that is
+// supposed to have produced it.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
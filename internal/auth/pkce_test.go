@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// BASE64URL(SHA256(verifier)), computed independently with openssl.
+	knownVerifier := "dBjftJeZ4CVP-mJ92K8ah4SzDo4rbHI0fYstHlOaLnU"
+	knownChallenge := "VkgYIHIKyM0xgbv_Oh7F7FF4E2lOMYOo0zV-HYRBQgU"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{
+			name:      "Known verifier",
+			verifier:  knownVerifier,
+			challenge: knownChallenge,
+			want:      true,
+		},
+		{
+			name:      "Wrong verifier",
+			verifier:  MakePKCEVerifier(),
+			challenge: knownChallenge,
+			want:      false,
+		},
+		{
+			name:      "Verifier too short",
+			verifier:  "abc",
+			challenge: PKCEChallenge("abc"),
+			want:      false,
+		},
+		{
+			name:      "Verifier with invalid characters",
+			verifier:  strings.Repeat("a", 42) + "+",
+			challenge: PKCEChallenge(strings.Repeat("a", 42) + "+"),
+			want:      false,
+		},
+		{
+			name:      "Plain challenge is not accepted",
+			verifier:  knownVerifier,
+			challenge: knownVerifier,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+type TokenKind string
+
+const (
+	TokenKindAccess              TokenKind = "access"
+	TokenKindPersonalAccessToken TokenKind = "personal_access_token"
+	TokenKindOAuth               TokenKind = "oauth"
+)
+
+const RoleAdmin = "admin"
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID uuid.UUID
+	Roles  []string
+	// Scopes limits what the credential may be used for. A nil slice means
+	// the credential is unrestricted, as is the case for first-party tokens.
+	Scopes []string
+	Kind   TokenKind
+}
+
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+type principalContextKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return p.UserID, true
+}
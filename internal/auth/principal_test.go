@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPrincipalHasScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		scope     string
+		want      bool
+	}{
+		{
+			name:      "Access token is unrestricted",
+			principal: Principal{Kind: TokenKindAccess},
+			scope:     ScopeAccount,
+			want:      true,
+		},
+		{
+			name:      "Granted scope",
+			principal: Principal{Kind: TokenKindPersonalAccessToken, Scopes: []string{ScopeChirpsRead, ScopeChirpsWrite}},
+			scope:     ScopeChirpsWrite,
+			want:      true,
+		},
+		{
+			name:      "Missing scope",
+			principal: Principal{Kind: TokenKindPersonalAccessToken, Scopes: []string{ScopeChirpsRead}},
+			scope:     ScopeChirpsWrite,
+			want:      false,
+		},
+		{
+			name:      "No scopes at all",
+			principal: Principal{Kind: TokenKindPersonalAccessToken, Scopes: []string{}},
+			scope:     ScopeChirpsRead,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.HasScope(tt.scope); got != tt.want {
+				t.Errorf("HasScope(%s) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	if _, ok := UserIDFromContext(context.Background()); ok {
+		t.Errorf("UserIDFromContext() found a user in an empty context")
+	}
+
+	userID := uuid.New()
+	ctx := ContextWithPrincipal(context.Background(), Principal{UserID: userID, Kind: TokenKindAccess})
+	got, ok := UserIDFromContext(ctx)
+	if !ok || got != userID {
+		t.Errorf("UserIDFromContext() = %v, %v, want %v, true", got, ok, userID)
+	}
+}
+
+func TestIsPersonalAccessToken(t *testing.T) {
+	if !IsPersonalAccessToken(MakePersonalAccessToken()) {
+		t.Errorf("IsPersonalAccessToken() didn't recognize a personal access token")
+	}
+	if IsPersonalAccessToken(MakeRefreshToken()) {
+		t.Errorf("IsPersonalAccessToken() accepted a refresh token")
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MakeRecoveryCodes returns n one-time MFA recovery codes formatted as
+// "xxxxx-xxxxx".
+func MakeRecoveryCodes(n int) []string {
+	codes := make([]string, 0, n)
+	for range n {
+		codeBytes := make([]byte, 7)
+		rand.Read(codeBytes)
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(codeBytes))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes
+}
+
+// NormalizeRecoveryCode strips the separators and case a user may have typed
+// so that the code hashes the same way it did when it was issued.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return code
+}
+
+// HashToken returns the hex encoded SHA-256 of a high-entropy secret such as
+// a recovery code, so that it can be stored and looked up without keeping
+// the secret itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
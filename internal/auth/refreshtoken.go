@@ -3,6 +3,7 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"strings"
 )
 
 func MakeRefreshToken() string {
@@ -10,3 +11,15 @@ func MakeRefreshToken() string {
 	rand.Read(tokenBytes)
 	return hex.EncodeToString(tokenBytes)
 }
+
+// personalAccessTokenPrefix makes personal access tokens recognizable, both
+// to the authentication path and to secret scanners.
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() string {
+	return personalAccessTokenPrefix + MakeRefreshToken()
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
@@ -0,0 +1,31 @@
+package auth
+
+import "slices"
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	ScopeWebhooks     = "webhooks"
+	// ScopeAdmin can only be granted to users with the admin role.
+	ScopeAdmin = "admin"
+	// ScopeAccount covers managing credentials, such as two-factor
+	// authentication and access tokens. It is never granted to delegated
+	// credentials, so only a user's own login sessions have it.
+	ScopeAccount = "account"
+)
+
+// GrantableScopes are the scopes delegated credentials may request.
+var GrantableScopes = []string{
+	ScopeChirpsRead,
+	ScopeChirpsWrite,
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeWebhooks,
+	ScopeAdmin,
+}
+
+func IsGrantableScope(scope string) bool {
+	return slices.Contains(GrantableScopes, scope)
+}
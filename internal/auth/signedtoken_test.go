@@ -0,0 +1,51 @@
+package auth
+
+import "testing"
+
+func TestValidSignedToken(t *testing.T) {
+	token := MakeSignedToken("secret")
+	tampered := "0" + token[1:]
+	if token[0] == '0' {
+		tampered = "1" + token[1:]
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		secret string
+		want   bool
+	}{
+		{
+			name:   "Valid token",
+			token:  token,
+			secret: "secret",
+			want:   true,
+		},
+		{
+			name:   "Wrong secret",
+			token:  token,
+			secret: "wrong_secret",
+			want:   false,
+		},
+		{
+			name:   "Tampered token",
+			token:  tampered,
+			secret: "secret",
+			want:   false,
+		},
+		{
+			name:   "Unsigned token",
+			token:  MakeRefreshToken(),
+			secret: "secret",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidSignedToken(tt.secret, tt.token); got != tt.want {
+				t.Errorf("ValidSignedToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
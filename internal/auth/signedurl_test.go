@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignedURL(t *testing.T) {
+	valid := SignURL("secret", "/api/exports/1/download", time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name    string
+		url     string
+		secret  string
+		wantErr error
+	}{
+		{
+			name:    "Valid URL",
+			url:     valid,
+			secret:  "secret",
+			wantErr: nil,
+		},
+		{
+			name:    "Wrong secret",
+			url:     valid,
+			secret:  "wrong_secret",
+			wantErr: ErrInvalidURLSignature,
+		},
+		{
+			name:    "Other path",
+			url:     strings.Replace(valid, "/1/", "/2/", 1),
+			secret:  "secret",
+			wantErr: ErrInvalidURLSignature,
+		},
+		{
+			name:    "Extended expiry",
+			url:     strings.Replace(valid, "expires=", "expires=9", 1),
+			secret:  "secret",
+			wantErr: ErrInvalidURLSignature,
+		},
+		{
+			name:    "Expired",
+			url:     SignURL("secret", "/api/exports/1/download", time.Now().Add(-time.Minute)),
+			secret:  "secret",
+			wantErr: ErrSignedURLExpired,
+		},
+		{
+			name:    "Unsigned",
+			url:     "/api/exports/1/download",
+			secret:  "secret",
+			wantErr: ErrInvalidURLSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("Couldn't parse URL: %v", err)
+			}
+			if err := VerifySignedURL(tt.secret, u); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifySignedURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
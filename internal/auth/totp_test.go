@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B (SHA-1), truncated to six digits.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name     string
+		unixTime int64
+		wantCode string
+	}{
+		{name: "59", unixTime: 59, wantCode: "287082"},
+		{name: "1111111109", unixTime: 1111111109, wantCode: "081804"},
+		{name: "1234567890", unixTime: 1234567890, wantCode: "005924"},
+		{name: "2000000000", unixTime: 2000000000, wantCode: "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unixTime, 0)))
+			if err != nil {
+				t.Fatalf("TOTPCode() error = %v", err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("TOTPCode() = %s, want %s", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	now := time.Now()
+	step := TOTPStep(now)
+	current, _ := TOTPCode(secret, step)
+	previous, _ := TOTPCode(secret, step-1)
+	stale, _ := TOTPCode(secret, step-5)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current step", code: current, wantStep: step, wantOK: true},
+		{name: "Previous step within skew", code: previous, wantStep: step - 1, wantOK: true},
+		{name: "Stale step", code: stale, wantOK: false},
+		{name: "Wrong length", code: "123", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(secret, tt.code, now)
+			if ok != tt.wantOK {
+				t.Errorf("ValidateTOTP() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() step = %d, want %d", gotStep, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "walt@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:walt@example.com?") {
+		t.Errorf("TOTPURI() = %s, unexpected label", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("TOTPURI() = %s, missing secret", uri)
+	}
+}
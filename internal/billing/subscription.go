@@ -0,0 +1,189 @@
+// Package billing tracks Chirpy Red subscriptions through the events Polka
+// sends about them.
+//
+// A subscription starts active and stays so while Polka renews it. A failed
+// payment makes it past due, and a downgrade schedules it to cancel when the
+// paid period ends; either way the user keeps Chirpy Red until then. Once
+// the period has ended without a renewal, Expire ends it. A refund ends it
+// right away.
+package billing
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultPlan is the plan subscriptions are on when Polka doesn't say.
+const DefaultPlan = "chirpy_red"
+
+type Status string
+
+const (
+	StatusActive  Status = "active"
+	StatusPastDue Status = "past_due"
+	// StatusCanceled is a downgraded subscription whose period has ended.
+	StatusCanceled Status = "canceled"
+	// StatusExpired is a subscription whose period ended without a renewal.
+	StatusExpired  Status = "expired"
+	StatusRefunded Status = "refunded"
+)
+
+const (
+	EventUpgraded      = "user.upgraded"
+	EventRenewed       = "user.renewed"
+	EventDowngraded    = "user.downgraded"
+	EventPaymentFailed = "user.payment_failed"
+	EventRefunded      = "user.refunded"
+)
+
+var (
+	ErrUnknownEvent   = errors.New("unknown subscription event")
+	ErrNoSubscription = errors.New("user has no subscription to change")
+)
+
+type Subscription struct {
+	Plan        string
+	Status      Status
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	// CancelAt is when a downgraded subscription ends, or zero.
+	CancelAt time.Time
+}
+
+// Event is a change to a user's subscription reported by Polka.
+type Event struct {
+	Type string
+	// Plan and PeriodEnd are optional. Without PeriodEnd, paid periods last
+	// a month.
+	Plan      string
+	PeriodEnd time.Time
+	// At is when the event happened.
+	At time.Time
+}
+
+// IsEvent reports whether eventType is a subscription event.
+func IsEvent(eventType string) bool {
+	switch eventType {
+	case EventUpgraded, EventRenewed, EventDowngraded, EventPaymentFailed, EventRefunded:
+		return true
+	}
+	return false
+}
+
+// Live reports whether the subscription hasn't ended yet, though its
+// period may have.
+func (s Subscription) Live() bool {
+	return s.Status == StatusActive || s.Status == StatusPastDue
+}
+
+// Entitled reports whether the subscription gives its user Chirpy Red at
+// time now.
+func (s Subscription) Entitled(now time.Time) bool {
+	return s.Live() && now.Before(s.PeriodEnd)
+}
+
+// Apply returns the subscription after event, given the user's latest
+// subscription, or nil if they never had one. started is true when the event
+// begins a new subscription rather than changing current.
+func Apply(current *Subscription, event Event) (next Subscription, started bool, err error) {
+	live := current != nil && current.Live()
+	switch event.Type {
+	case EventUpgraded:
+		// A subscription whose period ended before the upgrade is over,
+		// even if it hasn't been expired yet, so the upgrade starts a new
+		// one rather than inherit the stale period.
+		if live && event.At.Before(current.PeriodEnd) {
+			// Upgrading again undoes a pending downgrade.
+			next = *current
+			next.CancelAt = time.Time{}
+			if event.Plan != "" {
+				next.Plan = event.Plan
+			}
+			if event.PeriodEnd.After(next.PeriodEnd) {
+				next.PeriodEnd = event.PeriodEnd
+			}
+			return next, false, nil
+		}
+		return start(event), true, nil
+
+	case EventRenewed:
+		if !live {
+			// A renewal that arrives after the subscription expired still
+			// paid for a period.
+			return start(event), true, nil
+		}
+		next = *current
+		next.Status = StatusActive
+		next.PeriodStart = next.PeriodEnd
+		if next.PeriodStart.Before(event.At) {
+			next.PeriodStart = event.At
+		}
+		next.PeriodEnd = periodEnd(next.PeriodStart, event.PeriodEnd)
+		if event.Plan != "" {
+			next.Plan = event.Plan
+		}
+		return next, false, nil
+
+	case EventDowngraded:
+		if !live {
+			return Subscription{}, false, ErrNoSubscription
+		}
+		next = *current
+		next.CancelAt = next.PeriodEnd
+		return next, false, nil
+
+	case EventPaymentFailed:
+		if !live {
+			return Subscription{}, false, ErrNoSubscription
+		}
+		next = *current
+		next.Status = StatusPastDue
+		return next, false, nil
+
+	case EventRefunded:
+		if current == nil || current.Status == StatusRefunded {
+			return Subscription{}, false, ErrNoSubscription
+		}
+		next = *current
+		next.Status = StatusRefunded
+		if next.PeriodEnd.After(event.At) {
+			next.PeriodEnd = event.At
+		}
+		return next, false, nil
+	}
+	return Subscription{}, false, ErrUnknownEvent
+}
+
+// Expire ends a live subscription whose period is over at time now. It
+// returns false if the subscription doesn't need to change.
+func Expire(s Subscription, now time.Time) (Subscription, bool) {
+	if !s.Live() || now.Before(s.PeriodEnd) {
+		return s, false
+	}
+	if !s.CancelAt.IsZero() {
+		s.Status = StatusCanceled
+	} else {
+		s.Status = StatusExpired
+	}
+	return s, true
+}
+
+func start(event Event) Subscription {
+	plan := event.Plan
+	if plan == "" {
+		plan = DefaultPlan
+	}
+	return Subscription{
+		Plan:        plan,
+		Status:      StatusActive,
+		PeriodStart: event.At,
+		PeriodEnd:   periodEnd(event.At, event.PeriodEnd),
+	}
+}
+
+func periodEnd(start, end time.Time) time.Time {
+	if end.After(start) {
+		return end
+	}
+	return start.AddDate(0, 1, 0)
+}
@@ -0,0 +1,214 @@
+package billing
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	periodEnd := now.AddDate(0, 0, 20)
+	active := &Subscription{
+		Plan:        DefaultPlan,
+		Status:      StatusActive,
+		PeriodStart: now.AddDate(0, 0, -10),
+		PeriodEnd:   periodEnd,
+	}
+	downgraded := &Subscription{
+		Plan:        DefaultPlan,
+		Status:      StatusActive,
+		PeriodStart: active.PeriodStart,
+		PeriodEnd:   periodEnd,
+		CancelAt:    periodEnd,
+	}
+	pastDue := &Subscription{
+		Plan:        DefaultPlan,
+		Status:      StatusPastDue,
+		PeriodStart: active.PeriodStart,
+		PeriodEnd:   periodEnd,
+	}
+	expired := &Subscription{
+		Plan:        DefaultPlan,
+		Status:      StatusExpired,
+		PeriodStart: now.AddDate(0, -2, 0),
+		PeriodEnd:   now.AddDate(0, -1, 0),
+	}
+
+	tests := []struct {
+		name        string
+		current     *Subscription
+		event       Event
+		want        Subscription
+		wantStarted bool
+		wantErr     error
+	}{
+		{
+			name:    "Upgrade starts a subscription",
+			current: nil,
+			event:   Event{Type: EventUpgraded, At: now},
+			want: Subscription{
+				Plan:        DefaultPlan,
+				Status:      StatusActive,
+				PeriodStart: now,
+				PeriodEnd:   now.AddDate(0, 1, 0),
+			},
+			wantStarted: true,
+		},
+		{
+			name:    "Upgrade after expiry starts a new subscription",
+			current: expired,
+			event:   Event{Type: EventUpgraded, Plan: "chirpy_red_yearly", PeriodEnd: now.AddDate(1, 0, 0), At: now},
+			want: Subscription{
+				Plan:        "chirpy_red_yearly",
+				Status:      StatusActive,
+				PeriodStart: now,
+				PeriodEnd:   now.AddDate(1, 0, 0),
+			},
+			wantStarted: true,
+		},
+		{
+			name:    "Upgrade after the period ended starts a new subscription",
+			current: active,
+			event:   Event{Type: EventUpgraded, At: periodEnd.Add(time.Hour)},
+			want: Subscription{
+				Plan:        DefaultPlan,
+				Status:      StatusActive,
+				PeriodStart: periodEnd.Add(time.Hour),
+				PeriodEnd:   periodEnd.Add(time.Hour).AddDate(0, 1, 0),
+			},
+			wantStarted: true,
+		},
+		{
+			name:    "Upgrade undoes a downgrade",
+			current: downgraded,
+			event:   Event{Type: EventUpgraded, At: now},
+			want:    *active,
+		},
+		{
+			name:    "Renewal extends the period",
+			current: pastDue,
+			event:   Event{Type: EventRenewed, At: now},
+			want: Subscription{
+				Plan:        DefaultPlan,
+				Status:      StatusActive,
+				PeriodStart: periodEnd,
+				PeriodEnd:   periodEnd.AddDate(0, 1, 0),
+			},
+		},
+		{
+			name:    "Renewal after expiry starts a new subscription",
+			current: expired,
+			event:   Event{Type: EventRenewed, At: now},
+			want: Subscription{
+				Plan:        DefaultPlan,
+				Status:      StatusActive,
+				PeriodStart: now,
+				PeriodEnd:   now.AddDate(0, 1, 0),
+			},
+			wantStarted: true,
+		},
+		{
+			name:    "Downgrade cancels at period end",
+			current: active,
+			event:   Event{Type: EventDowngraded, At: now},
+			want:    *downgraded,
+		},
+		{
+			name:    "Downgrade without a subscription",
+			current: expired,
+			event:   Event{Type: EventDowngraded, At: now},
+			wantErr: ErrNoSubscription,
+		},
+		{
+			name:    "Failed payment",
+			current: active,
+			event:   Event{Type: EventPaymentFailed, At: now},
+			want:    *pastDue,
+		},
+		{
+			name:    "Refund ends the subscription now",
+			current: active,
+			event:   Event{Type: EventRefunded, At: now},
+			want: Subscription{
+				Plan:        DefaultPlan,
+				Status:      StatusRefunded,
+				PeriodStart: active.PeriodStart,
+				PeriodEnd:   now,
+			},
+		},
+		{
+			name:    "Refund without a subscription",
+			current: nil,
+			event:   Event{Type: EventRefunded, At: now},
+			wantErr: ErrNoSubscription,
+		},
+		{
+			name:    "Unknown event",
+			current: active,
+			event:   Event{Type: "user.gifted", At: now},
+			wantErr: ErrUnknownEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, started, err := Apply(tt.current, tt.event)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Apply() = %+v, want %+v", got, tt.want)
+			}
+			if started != tt.wantStarted {
+				t.Errorf("Apply() started = %v, want %v", started, tt.wantStarted)
+			}
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		sub         Subscription
+		wantStatus  Status
+		wantChanged bool
+	}{
+		{
+			name:       "Period not over",
+			sub:        Subscription{Status: StatusActive, PeriodEnd: now.Add(time.Hour)},
+			wantStatus: StatusActive,
+		},
+		{
+			name:        "Lapsed",
+			sub:         Subscription{Status: StatusPastDue, PeriodEnd: now.Add(-time.Hour)},
+			wantStatus:  StatusExpired,
+			wantChanged: true,
+		},
+		{
+			name:        "Downgraded",
+			sub:         Subscription{Status: StatusActive, PeriodEnd: now, CancelAt: now},
+			wantStatus:  StatusCanceled,
+			wantChanged: true,
+		},
+		{
+			name:       "Already ended",
+			sub:        Subscription{Status: StatusRefunded, PeriodEnd: now.Add(-time.Hour)},
+			wantStatus: StatusRefunded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := Expire(tt.sub, now)
+			if got.Status != tt.wantStatus || changed != tt.wantChanged {
+				t.Errorf("Expire() = %v, %v, want %v, %v", got.Status, changed, tt.wantStatus, tt.wantChanged)
+			}
+			if changed && got.Entitled(now) {
+				t.Errorf("Expire() left the subscription entitled")
+			}
+		})
+	}
+}
@@ -7,9 +7,11 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
@@ -22,7 +24,7 @@ VALUES (
     $3,
     NULL
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
 `
 
 type CreateRefreshTokenParams struct {
@@ -41,14 +43,91 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    NULL,
+    $4,
+    $5
+)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	ClientID  sql.NullString
+	Scopes    []string
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getOAuthRefreshToken = `-- name: GetOAuthRefreshToken :one
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes FROM refresh_tokens
+WHERE token = $1
+AND client_id = $2
+AND revoked_at IS NULL
+AND expires_at > NOW()
+`
+
+type GetOAuthRefreshTokenParams struct {
+	Token    string
+	ClientID sql.NullString
+}
+
+func (q *Queries) GetOAuthRefreshToken(ctx context.Context, arg GetOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthRefreshToken, arg.Token, arg.ClientID)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red FROM users
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.email_verified_at, users.deactivated_at FROM users
     JOIN refresh_tokens ON users.id = refresh_tokens.user_id
         WHERE refresh_tokens.token = $1
+        AND refresh_tokens.client_id IS NULL
         AND revoked_at IS NULL
         AND expires_at > NOW()
 `
@@ -63,10 +142,107 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (Us
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
+const listRefreshTokensForUser = `-- name: ListRefreshTokensForUser :many
+SELECT created_at, expires_at, revoked_at, client_id FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+type ListRefreshTokensForUserRow struct {
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	ClientID  sql.NullString
+}
+
+func (q *Queries) ListRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]ListRefreshTokensForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRefreshTokensForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRefreshTokensForUserRow
+	for rows.Next() {
+		var i ListRefreshTokensForUserRow
+		if err := rows.Scan(
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.ClientID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE user_id = $1
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
+	return err
+}
+
+const revokeOAuthRefreshToken = `-- name: RevokeOAuthRefreshToken :execrows
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE token = $1
+    AND client_id = $2
+    AND revoked_at IS NULL
+`
+
+type RevokeOAuthRefreshTokenParams struct {
+	Token    string
+	ClientID sql.NullString
+}
+
+func (q *Queries) RevokeOAuthRefreshToken(ctx context.Context, arg RevokeOAuthRefreshTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeOAuthRefreshToken, arg.Token, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeOAuthRefreshTokensForUser = `-- name: RevokeOAuthRefreshTokensForUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE user_id = $1
+    AND client_id = $2
+    AND revoked_at IS NULL
+`
+
+type RevokeOAuthRefreshTokensForUserParams struct {
+	UserID   uuid.UUID
+	ClientID sql.NullString
+}
+
+func (q *Queries) RevokeOAuthRefreshTokensForUser(ctx context.Context, arg RevokeOAuthRefreshTokensForUserParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOAuthRefreshTokensForUser, arg.UserID, arg.ClientID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
     SET revoked_at = NOW(),
@@ -78,3 +254,35 @@ func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
 	return err
 }
+
+const revokeRefreshTokenByHash = `-- name: RevokeRefreshTokenByHash :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE user_id = $1
+    AND encode(sha256(convert_to(token, 'UTF8')), 'hex') = $2::text
+`
+
+type RevokeRefreshTokenByHashParams struct {
+	UserID    uuid.UUID
+	TokenHash string
+}
+
+func (q *Queries) RevokeRefreshTokenByHash(ctx context.Context, arg RevokeRefreshTokenByHashParams) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenByHash, arg.UserID, arg.TokenHash)
+	return err
+}
+
+const deleteStaleRefreshTokens = `-- name: DeleteStaleRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < $1
+OR revoked_at < $1
+`
+
+func (q *Queries) DeleteStaleRefreshTokens(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleRefreshTokens, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -7,10 +7,41 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countPasswordHashes = `-- name: CountPasswordHashes :one
+SELECT
+    COUNT(*) FILTER (WHERE hashed_password LIKE '$argon2id$%') AS total,
+    COUNT(*) FILTER (
+        WHERE hashed_password LIKE '$argon2id$%'
+        AND (
+            hashed_password NOT LIKE $1::text || '%'
+            OR length(hashed_password) <> $2::int
+        )
+    ) AS legacy
+FROM users
+`
+
+type CountPasswordHashesParams struct {
+	CurrentPrefix string
+	CurrentLength int32
+}
+
+type CountPasswordHashesRow struct {
+	Total  int64
+	Legacy int64
+}
+
+func (q *Queries) CountPasswordHashes(ctx context.Context, arg CountPasswordHashesParams) (CountPasswordHashesRow, error) {
+	row := q.db.QueryRowContext(ctx, countPasswordHashes, arg.CurrentPrefix, arg.CurrentLength)
+	var i CountPasswordHashesRow
+	err := row.Scan(&i.Total, &i.Legacy)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -20,7 +51,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, deactivated_at
 `
 
 type CreateUserParams struct {
@@ -38,10 +69,49 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
+const deactivateUser = `-- name: DeactivateUser :one
+UPDATE users
+    SET deactivated_at = COALESCE(deactivated_at, NOW()),
+        updated_at = NOW()
+    WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, deactivated_at
+`
+
+func (q *Queries) DeactivateUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, deactivateUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.DeactivatedAt,
+	)
+	return i, err
+}
+
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 DELETE FROM users
 `
@@ -52,8 +122,8 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
-WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, deactivated_at FROM users
+WHERE lower(email) = lower($1)
 LIMIT 1
 `
 
@@ -67,12 +137,14 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, deactivated_at FROM users
 WHERE id = $1
 LIMIT 1
 `
@@ -87,17 +159,111 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
+const isUserActive = `-- name: IsUserActive :one
+SELECT deactivated_at IS NULL AS active FROM users
+WHERE id = $1
+`
+
+func (q *Queries) IsUserActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUserActive, id)
+	var active bool
+	err := row.Scan(&active)
+	return active, err
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :execrows
+UPDATE users
+    SET email_verified_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1
+    AND email = $2
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeDeactivatedUsers = `-- name: PurgeDeactivatedUsers :many
+DELETE FROM users
+WHERE deactivated_at < $1
+RETURNING id
+`
+
+func (q *Queries) PurgeDeactivatedUsers(ctx context.Context, deactivatedAt sql.NullTime) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeactivatedUsers, deactivatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const reactivateUser = `-- name: ReactivateUser :exec
+UPDATE users
+    SET deactivated_at = NULL,
+        updated_at = NOW()
+    WHERE id = $1
+`
+
+func (q *Queries) ReactivateUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, reactivateUser, id)
+	return err
+}
+
+const setUserChirpyRed = `-- name: SetUserChirpyRed :exec
+UPDATE users
+    SET is_chirpy_red = $2,
+        updated_at = NOW()
+    WHERE id = $1
+`
+
+type SetUserChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) error {
+	_, err := q.db.ExecContext(ctx, setUserChirpyRed, arg.ID, arg.IsChirpyRed)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
     SET email = $1,
         hashed_password = $2,
+        email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END,
         updated_at = NOW()
     WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, deactivated_at
 `
 
 type UpdateUserParams struct {
@@ -116,17 +282,25 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.DeactivatedAt,
 	)
 	return i, err
 }
 
-const upgradeUser = `-- name: UpgradeUser :exec
+const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users
-    SET is_chirpy_red = true
+    SET hashed_password = $2,
+        updated_at = NOW()
     WHERE id = $1
 `
 
-func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, upgradeUser, id)
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
 	return err
 }
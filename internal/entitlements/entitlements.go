@@ -0,0 +1,68 @@
+// Package entitlements maps plans to what their users can do.
+//
+// Handlers check entitlements rather than plans, so perks can move between
+// plans, or new plans be added, by changing the table here.
+package entitlements
+
+import "slices"
+
+// PlanFree is the plan of users without a subscription.
+const PlanFree = "free"
+
+type Feature string
+
+// Features are only added for things Chirpy can do: there are no media,
+// analytics or badge features, for instance, as Chirpy has none of those.
+const (
+	FeatureEditChirps Feature = "edit_chirps"
+)
+
+type Entitlements struct {
+	Plan           string `json:"plan"`
+	MaxChirpLength int    `json:"max_chirp_length"`
+	// ChirpsPerHour limits how many chirps a user may post in an hour.
+	ChirpsPerHour int       `json:"chirps_per_hour"`
+	Features      []Feature `json:"features"`
+}
+
+var free = Entitlements{
+	Plan:           PlanFree,
+	MaxChirpLength: 140,
+	ChirpsPerHour:  60,
+	Features:       []Feature{},
+}
+
+var red = Entitlements{
+	MaxChirpLength: 1000,
+	ChirpsPerHour:  300,
+	Features:       []Feature{FeatureEditChirps},
+}
+
+// plans are the entitlements of each paid plan.
+var plans = map[string]Entitlements{
+	"chirpy_red":        red,
+	"chirpy_red_yearly": red,
+}
+
+// Free returns the entitlements of users without a subscription.
+func Free() Entitlements {
+	return For(PlanFree)
+}
+
+// For returns the entitlements of plan. Unknown plans get the free plan's.
+func For(plan string) Entitlements {
+	e, ok := plans[plan]
+	if !ok {
+		e = free
+	}
+	if e.Plan == "" {
+		e.Plan = plan
+	}
+	e.Features = slices.Clone(e.Features)
+	return e
+}
+
+// Has reports whether the entitlements include feature.
+func (e Entitlements) Has(feature Feature) bool {
+	return slices.Contains(e.Features, feature)
+}
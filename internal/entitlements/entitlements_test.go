@@ -0,0 +1,35 @@
+package entitlements
+
+import "testing"
+
+func TestFor(t *testing.T) {
+	tests := []struct {
+		name          string
+		plan          string
+		wantPlan      string
+		wantMaxLength int
+		wantEdit      bool
+	}{
+		{name: "Free", plan: PlanFree, wantPlan: PlanFree, wantMaxLength: 140, wantEdit: false},
+		{name: "Chirpy Red", plan: "chirpy_red", wantPlan: "chirpy_red", wantMaxLength: 1000, wantEdit: true},
+		{name: "Yearly Chirpy Red", plan: "chirpy_red_yearly", wantPlan: "chirpy_red_yearly", wantMaxLength: 1000, wantEdit: true},
+		{name: "Unknown plan", plan: "chirpy_gold", wantPlan: PlanFree, wantMaxLength: 140, wantEdit: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := For(tt.plan)
+			if got.Plan != tt.wantPlan || got.MaxChirpLength != tt.wantMaxLength || got.Has(FeatureEditChirps) != tt.wantEdit {
+				t.Errorf("For(%q) = %+v, want plan %q, max length %d, edit %v", tt.plan, got, tt.wantPlan, tt.wantMaxLength, tt.wantEdit)
+			}
+		})
+	}
+}
+
+func TestForReturnsCopies(t *testing.T) {
+	e := For("chirpy_red")
+	e.Features[0] = "something_else"
+	if !For("chirpy_red").Has(FeatureEditChirps) {
+		t.Errorf("changing returned entitlements changed the plan")
+	}
+}
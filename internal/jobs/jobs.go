@@ -0,0 +1,285 @@
+// Package jobs runs background work from a queue stored in Postgres, so it
+// survives restarts and is shared by every server.
+//
+// Workers claim jobs with SELECT ... FOR UPDATE SKIP LOCKED, and hold them
+// for a lease. A job whose worker stops before finishing it is claimed again
+// once the lease runs out, so handlers must cope with running more than once.
+// Only the worker holding the current lease records how the job went.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/database"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+
+	DefaultMaxAttempts = 5
+	DefaultTimeout     = time.Minute
+	// DefaultPollInterval is how often idle workers look for jobs that
+	// other servers queued, or that have come due.
+	DefaultPollInterval = time.Second
+
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = time.Hour
+	// leaseMargin is how long a job is held beyond its timeout, so that
+	// recording the outcome doesn't race with another worker claiming it.
+	leaseMargin = 30 * time.Second
+)
+
+// ErrDuplicate is returned when enqueueing a job whose unique key is held by
+// a job that is still queued or running.
+var ErrDuplicate = errors.New("a job with the same unique key is already queued")
+
+// Kind is a type of job, whose arguments are a T encoded as JSON.
+type Kind[T any] struct {
+	Name string
+	// MaxAttempts is how many times a job is tried before it fails for
+	// good. It defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Timeout bounds each attempt. It defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Options control when and whether a job is enqueued.
+type Options struct {
+	// RunAt delays the job until then, instead of running it right away.
+	RunAt time.Time
+	// UniqueKey, if set, keeps the job from being enqueued while another
+	// job with the same key is queued or running.
+	UniqueKey string
+}
+
+// Enqueue adds a job of kind k to the queue.
+func (k Kind[T]) Enqueue(ctx context.Context, q *Queue, args T, opts Options) (database.Job, error) {
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return database.Job{}, err
+	}
+	runAt := opts.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	maxAttempts := k.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	job, err := q.db.EnqueueJob(ctx, database.EnqueueJobParams{
+		Kind:        k.Name,
+		Args:        encoded,
+		MaxAttempts: int32(maxAttempts),
+		RunAt:       runAt.UTC(),
+		UniqueKey:   sql.NullString{String: opts.UniqueKey, Valid: opts.UniqueKey != ""},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Job{}, fmt.Errorf("%w: %s", ErrDuplicate, opts.UniqueKey)
+	}
+	if err != nil {
+		return database.Job{}, err
+	}
+	if !runAt.After(time.Now()) {
+		q.wakeWorker()
+	}
+	return job, nil
+}
+
+// Handle registers handle to run jobs of kind k. Handlers must be registered
+// before the queue runs.
+func Handle[T any](q *Queue, k Kind[T], handle func(context.Context, T) error) {
+	timeout := k.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	q.handlers[k.Name] = handler{
+		timeout: timeout,
+		run: func(ctx context.Context, args json.RawMessage) error {
+			var decoded T
+			if err := json.Unmarshal(args, &decoded); err != nil {
+				return Permanent(fmt.Errorf("couldn't decode arguments: %w", err))
+			}
+			return handle(ctx, decoded)
+		},
+	}
+	q.kinds = append(q.kinds, k.Name)
+	q.lease = max(q.lease, timeout+leaseMargin)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying won't fix, so the job fails
+// without using up its remaining attempts.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type attemptContextKey struct{}
+
+// LastAttempt reports whether the job running with ctx won't be retried if
+// it fails, so its handler can clean up.
+func LastAttempt(ctx context.Context) bool {
+	last, _ := ctx.Value(attemptContextKey{}).(bool)
+	return last
+}
+
+// Backoff is how long to wait before retrying a job that has failed
+// attempts times, doubling each time up to an hour.
+func Backoff(attempts int32) time.Duration {
+	delay := retryBaseDelay
+	for i := int32(1); i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
+type handler struct {
+	timeout time.Duration
+	run     func(context.Context, json.RawMessage) error
+}
+
+// Queue runs jobs with the handlers registered for their kinds.
+type Queue struct {
+	db       *database.Queries
+	handlers map[string]handler
+	// kinds are the kinds with handlers. Workers only claim jobs of
+	// these, so servers running an older version leave new kinds alone.
+	kinds []string
+	lease time.Duration
+	wake  chan struct{}
+
+	PollInterval time.Duration
+}
+
+func New(db *database.Queries) *Queue {
+	return &Queue{
+		db:           db,
+		handlers:     map[string]handler{},
+		wake:         make(chan struct{}, 1),
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// wakeWorker gets an idle worker to look for jobs now, rather than at its
+// next poll.
+func (q *Queue) wakeWorker() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs jobs with the given number of workers until ctx is done. It then
+// stops claiming jobs, and returns once the running ones have finished.
+func (q *Queue) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() { q.work(ctx) })
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		ran, err := q.runNext(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Couldn't run job", "error", err)
+		}
+		if ran {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-time.After(q.PollInterval):
+		}
+	}
+}
+
+// runNext claims a job and runs it, reporting whether there was one.
+func (q *Queue) runNext(ctx context.Context) (bool, error) {
+	if len(q.kinds) == 0 {
+		return false, nil
+	}
+	job, err := q.db.ClaimJob(ctx, database.ClaimJobParams{
+		LockedUntil: sql.NullTime{Time: time.Now().UTC().Add(q.lease), Valid: true},
+		Kinds:       q.kinds,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Jobs that have started are finished even if ctx is done, so that
+	// shutting down drains the queue instead of abandoning them.
+	ctx = context.WithoutCancel(ctx)
+	h := q.handlers[job.Kind]
+	last := job.Attempts >= job.MaxAttempts
+	runErr := runHandler(context.WithValue(ctx, attemptContextKey{}, last), h, job.Args)
+	return true, q.finish(ctx, job, last, runErr)
+}
+
+func runHandler(ctx context.Context, h handler, args json.RawMessage) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.run(ctx, args)
+}
+
+// finish records how a job's attempt went, scheduling a retry if it failed
+// and may still succeed. The outcome is dropped if the worker's lease ran out
+// and another worker claimed the job since, as that worker's outcome is the
+// one that counts.
+func (q *Queue) finish(ctx context.Context, job database.Job, last bool, runErr error) error {
+	var rows int64
+	var err error
+	var lastError sql.NullString
+	if runErr != nil {
+		lastError = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	var permanent permanentError
+	switch {
+	case runErr == nil:
+		rows, err = q.db.CompleteJob(ctx, database.CompleteJobParams{ID: job.ID, LockedUntil: job.LockedUntil})
+	case last || errors.As(runErr, &permanent):
+		slog.Error("Job failed", "job_id", job.ID, "kind", job.Kind, "error", runErr)
+		rows, err = q.db.FailJob(ctx, database.FailJobParams{ID: job.ID, LastError: lastError, LockedUntil: job.LockedUntil})
+	default:
+		slog.Warn("Job failed, retrying", "job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "error", runErr)
+		rows, err = q.db.RetryJob(ctx, database.RetryJobParams{
+			ID:          job.ID,
+			RunAt:       time.Now().UTC().Add(Backoff(job.Attempts)),
+			LastError:   lastError,
+			LockedUntil: job.LockedUntil,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		slog.Warn("Job's lease ran out before it finished, dropping its outcome", "job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+	}
+	return nil
+}
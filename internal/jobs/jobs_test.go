@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{attempts: 1, want: 10 * time.Second},
+		{attempts: 2, want: 20 * time.Second},
+		{attempts: 4, want: 80 * time.Second},
+		{attempts: 9, want: 2560 * time.Second},
+		{attempts: 10, want: time.Hour},
+		{attempts: 100, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("bad arguments")
+	err := Permanent(cause)
+	var permanent permanentError
+	if !errors.As(err, &permanent) || !errors.Is(err, cause) {
+		t.Errorf("Permanent() = %v, want a permanent error wrapping %v", err, cause)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	type args struct {
+		Name string `json:"name"`
+	}
+	q := New(nil)
+	var got args
+	var last bool
+	Handle(q, Kind[args]{Name: "greet", Timeout: time.Second}, func(ctx context.Context, a args) error {
+		got = a
+		last = LastAttempt(ctx)
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("handler context has no deadline")
+		}
+		return nil
+	})
+	Handle(q, Kind[args]{Name: "panic"}, func(ctx context.Context, a args) error {
+		panic("oops")
+	})
+
+	ctx := context.WithValue(context.Background(), attemptContextKey{}, true)
+	if err := runHandler(ctx, q.handlers["greet"], json.RawMessage(`{"name":"chirpy"}`)); err != nil {
+		t.Fatalf("runHandler() error = %v", err)
+	}
+	if got.Name != "chirpy" || !last {
+		t.Errorf("handler got %+v, last attempt %v, want the decoded arguments on the last attempt", got, last)
+	}
+
+	var permanent permanentError
+	if err := runHandler(ctx, q.handlers["greet"], json.RawMessage(`"not an object"`)); !errors.As(err, &permanent) {
+		t.Errorf("runHandler() with bad arguments error = %v, want a permanent error", err)
+	}
+	if err := runHandler(ctx, q.handlers["panic"], json.RawMessage(`{}`)); err == nil {
+		t.Errorf("runHandler() with a panicking handler error = %v, wantErr %v", err, true)
+	}
+	if want := DefaultTimeout + leaseMargin; q.lease != want {
+		t.Errorf("lease = %v, want %v", q.lease, want)
+	}
+}
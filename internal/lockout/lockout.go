@@ -0,0 +1,51 @@
+package lockout
+
+import "time"
+
+// Policy describes how repeated failures lock out further attempts.
+//
+// The first MaxAttempts failures within Window are free. Every failure after
+// that locks out further attempts for BaseDelay, doubling with each
+// additional failure up to MaxDelay.
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Window is how long a failure is remembered. Once the last failure is
+	// older than Window, counting starts over.
+	Window time.Duration
+}
+
+func DefaultAccountPolicy() Policy {
+	return Policy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
+		Window:      time.Hour,
+	}
+}
+
+func DefaultIPPolicy() Policy {
+	return Policy{
+		MaxAttempts: 20,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
+		Window:      time.Hour,
+	}
+}
+
+// Delay returns how long to lock out further attempts after the given
+// number of consecutive failures.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures < p.MaxAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for range failures - p.MaxAttempts {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
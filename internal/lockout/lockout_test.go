@@ -0,0 +1,37 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Minute,
+		MaxDelay:    10 * time.Minute,
+		Window:      time.Hour,
+	}
+
+	tests := []struct {
+		name      string
+		failures  int
+		wantDelay time.Duration
+	}{
+		{name: "No failures", failures: 0, wantDelay: 0},
+		{name: "Below threshold", failures: 2, wantDelay: 0},
+		{name: "At threshold", failures: 3, wantDelay: time.Minute},
+		{name: "One over threshold", failures: 4, wantDelay: 2 * time.Minute},
+		{name: "Two over threshold", failures: 5, wantDelay: 4 * time.Minute},
+		{name: "Capped", failures: 7, wantDelay: 10 * time.Minute},
+		{name: "Far past cap", failures: 500, wantDelay: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Delay(tt.failures); got != tt.wantDelay {
+				t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Package logging sets up structured logs and ties them to requests.
+//
+// Middleware gives every request an ID and a logger carrying it, which
+// handlers get with FromContext, so whatever they log can be matched up with
+// the request's own log line.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	// RequestIDHeader carries request IDs in requests and responses.
+	RequestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds the request IDs accepted from clients.
+	maxRequestIDLength = 128
+)
+
+// NewHandler returns a handler writing to w in format, which is FormatJSON
+// or FormatText.
+func NewHandler(w io.Writer, format string) (slog.Handler, error) {
+	switch format {
+	case FormatJSON:
+		return slog.NewJSONHandler(w, nil), nil
+	case FormatText:
+		return slog.NewTextHandler(w, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q; expected %s or %s", format, FormatJSON, FormatText)
+	}
+}
+
+type loggerContextKey struct{}
+
+type requestContextKey struct{}
+
+// request is what the middleware learns about a request while it's served.
+type request struct {
+	id     string
+	userID string
+}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the logger for ctx, or the default logger if it has
+// none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// RequestIDFromContext returns the ID of the request ctx belongs to, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	if req, ok := ctx.Value(requestContextKey{}).(*request); ok {
+		return req.id
+	}
+	return ""
+}
+
+// WithUserID records who made the request ctx belongs to, both in its
+// request log line and in everything logged with the returned context.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	if req, ok := ctx.Value(requestContextKey{}).(*request); ok {
+		req.userID = userID
+	}
+	return WithLogger(ctx, FromContext(ctx).With("user_id", userID))
+}
+
+// Middleware logs every request to logger once it has been served. Requests
+// keep the ID in their X-Request-ID header, so one can be followed across
+// services, or are given a new one, and it's echoed in the response.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		req := &request{id: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(req.id) {
+			req.id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, req.id)
+
+		reqLogger := logger.With("request_id", req.id)
+		ctx := context.WithValue(r.Context(), requestContextKey{}, req)
+		r = r.WithContext(WithLogger(ctx, reqLogger))
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.statusCode()
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			// ServeMux sets the pattern on the request it was given.
+			slog.String("route", r.Pattern),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", rec.bytes),
+		}
+		if req.userID != "" {
+			attrs = append(attrs, slog.String("user_id", req.userID))
+		}
+		reqLogger.LogAttrs(ctx, levelFor(status), "Served request", attrs...)
+	})
+}
+
+func levelFor(status int) slog.Level {
+	if status >= http.StatusInternalServerError {
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// validRequestID reports whether a client's request ID is safe to log and
+// echo: short, and printable ASCII without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// responseRecorder notes the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		// Nothing was written, which net/http sends as a 200.
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewHandler(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{format: FormatJSON, wantErr: false},
+		{format: FormatText, wantErr: false},
+		{format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			_, err := NewHandler(&bytes.Buffer{}, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "UUID", id: "9c1f5e2a-3b4d-4e6f-8a7b-1c2d3e4f5a6b", want: true},
+		{name: "Empty", id: "", want: false},
+		{name: "Too long", id: strings.Repeat("a", maxRequestIDLength+1), want: false},
+		{name: "Spaces", id: "a b", want: false},
+		{name: "Newline", id: "a\nlevel=ERROR", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validRequestID(tt.id); got != tt.want {
+				t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithUserID(r.Context(), "user-1")
+		FromContext(ctx).Info("Handling")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	handler := Middleware(logger, mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps/123", nil)
+	req.Header.Set(RequestIDHeader, "from-the-proxy")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got != "from-the-proxy" {
+		t.Errorf("%s = %q, want the request's", RequestIDHeader, got)
+	}
+
+	var lines []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]any
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("Couldn't decode log line %s: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2", len(lines))
+	}
+	handled, served := lines[0], lines[1]
+	if handled["request_id"] != "from-the-proxy" || handled["user_id"] != "user-1" {
+		t.Errorf("handler log = %v, want the request and user IDs", handled)
+	}
+	want := map[string]any{
+		"msg":        "Served request",
+		"request_id": "from-the-proxy",
+		"method":     http.MethodPost,
+		"route":      "POST /api/chirps/{chirpID}",
+		"path":       "/api/chirps/123",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(len("hello")),
+		"user_id":    "user-1",
+	}
+	for key, value := range want {
+		if served[key] != value {
+			t.Errorf("request log %s = %v, want %v", key, served[key], value)
+		}
+	}
+	if _, ok := served["latency"]; !ok {
+		t.Errorf("request log = %v, want its latency", served)
+	}
+
+	// Requests without a usable ID are given one.
+	req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(RequestIDHeader, "not valid")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got == "" || got == "not valid" {
+		t.Errorf("%s = %q, want a new ID", RequestIDHeader, got)
+	}
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := NewLogMailer(dir, "chirpy@example.com")
+
+	err := m.Send(context.Background(), Message{
+		To:      "walt@example.com",
+		Subject: "Verify your email",
+		Body:    "Click here\nThanks",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected exactly one message file, got %d (err %v)", len(entries), err)
+	}
+	dat, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	for _, want := range []string{"To: walt@example.com\r\n", "Subject: Verify your email\r\n", "Click here\r\nThanks"} {
+		if !strings.Contains(string(dat), want) {
+			t.Errorf("message missing %q:\n%s", want, dat)
+		}
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	m := NewLogMailer(t.TempDir(), "chirpy@example.com")
+
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{
+			name: "No recipient",
+			msg:  Message{Subject: "Hi"},
+		},
+		{
+			name: "Line break in recipient",
+			msg:  Message{To: "walt@example.com\r\nBcc: jesse@example.com"},
+		},
+		{
+			name: "Line break in subject",
+			msg:  Message{To: "walt@example.com", Subject: "Hi\nBcc: jesse@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Send(context.Background(), tt.msg); err == nil {
+				t.Errorf("Send() expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one connection on a local port, answers just enough SMTP
+// for a plain send, and reports the commands it was sent.
+func fakeSMTP(t *testing.T) (host, port string, commands <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var seen []string
+		defer func() { ch <- seen }()
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			seen = append(seen, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				tp.PrintfLine("250 localhost")
+			case line == "DATA":
+				tp.PrintfLine("354 go ahead")
+				if _, err := tp.ReadDotLines(); err != nil {
+					return
+				}
+				tp.PrintfLine("250 queued")
+			case line == "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	host, port, _ = net.SplitHostPort(ln.Addr().String())
+	return host, port, ch
+}
+
+func TestNewSMTPMailerRejectsInvalidSender(t *testing.T) {
+	if _, err := NewSMTPMailer("localhost", "25", "", "", "not an address"); err == nil {
+		t.Errorf("NewSMTPMailer() expected an error")
+	}
+}
+
+func TestSMTPMailerUsesBareEnvelopeSender(t *testing.T) {
+	host, port, commands := fakeSMTP(t)
+	m, err := NewSMTPMailer(host, port, "", "", "Chirpy <no-reply@chirpy.local>")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	err = m.Send(context.Background(), Message{To: "walt@example.com", Subject: "Hi", Body: "Hello"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	seen := <-commands
+	want := "MAIL FROM:<no-reply@chirpy.local>"
+	for _, cmd := range seen {
+		if strings.HasPrefix(cmd, "MAIL FROM:") {
+			if !strings.HasPrefix(cmd, want) {
+				t.Errorf("got %q, want %q", cmd, want)
+			}
+			return
+		}
+	}
+	t.Errorf("no MAIL FROM command in %q", seen)
+}
+
+func TestSMTPMailerGivesUpWhenContextEnds(t *testing.T) {
+	// A relay that accepts connections but never greets.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(5 * time.Second)
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	m, err := NewSMTPMailer(host, port, "", "", "no-reply@chirpy.local")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.Send(ctx, Message{To: "walt@example.com"}); err == nil {
+		t.Fatalf("Send() expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send() took %v after its context ended", elapsed)
+	}
+}
@@ -0,0 +1,188 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/oidc/oidctest"
+)
+
+const testRedirectURL = "http://chirpy.test/api/login/oidc/callback"
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	mock := oidctest.NewProvider("chirpy", "secret")
+	t.Cleanup(mock.Close)
+	provider, err := Discover(context.Background(), mock.URL, "chirpy", "secret", testRedirectURL)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	return mock, provider
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorize follows the authorization URL to the mock provider and returns
+// the code it redirects back with.
+func authorize(t *testing.T, provider *Provider, state, nonce, verifier string) string {
+	t.Helper()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(provider.AuthCodeURL(state, nonce, pkceChallenge(verifier)))
+	if err != nil {
+		t.Fatalf("GET authorization endpoint: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Couldn't parse redirect: %v", err)
+	}
+	if location.Query().Get("state") != state {
+		t.Fatalf("redirect state = %q, want %q", location.Query().Get("state"), state)
+	}
+	return location.Query().Get("code")
+}
+
+func TestDiscoverRejectsMismatchedIssuer(t *testing.T) {
+	mock := oidctest.NewProvider("chirpy", "secret")
+	defer mock.Close()
+
+	if _, err := Discover(context.Background(), mock.URL+"/", "chirpy", "secret", testRedirectURL); err == nil {
+		t.Errorf("Discover() error = nil, want issuer mismatch")
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	mock.SetIdentity(oidctest.Identity{
+		Subject:       "employee-1",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+	})
+
+	verifier := "dBjftJeZ4CVP-mJ92K8ah4SzDo4rbHI0fYstHlOaLnU"
+	code := authorize(t, provider, "state", "nonce", verifier)
+
+	if _, err := provider.Exchange(context.Background(), code, "wrong-verifier-wrong-verifier-wrong-verifier"); err == nil {
+		t.Fatalf("Exchange() with wrong verifier error = nil, want error")
+	}
+
+	code = authorize(t, provider, "state", "nonce", verifier)
+	rawIDToken, err := provider.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), rawIDToken, "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	if claims.Subject != "employee-1" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("VerifyIDToken() = %+v, want the signed in identity", claims)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	identity := oidctest.Identity{Subject: "employee-1", Email: "alice@example.com", EmailVerified: true}
+
+	expired := mock.IDTokenClaims(identity, "nonce")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAudience := mock.IDTokenClaims(identity, "nonce")
+	wrongAudience["aud"] = "someone-else"
+	wrongIssuer := mock.IDTokenClaims(identity, "nonce")
+	wrongIssuer["iss"] = "https://evil.example.com"
+	noExpiry := mock.IDTokenClaims(identity, "nonce")
+	delete(noExpiry, "exp")
+	stringVerified := mock.IDTokenClaims(identity, "nonce")
+	stringVerified["email_verified"] = "true"
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr bool
+	}{
+		{
+			name:    "Valid token",
+			token:   mock.SignIDToken(mock.IDTokenClaims(identity, "nonce")),
+			nonce:   "nonce",
+			wantErr: false,
+		},
+		{
+			name:    "Email verified as string",
+			token:   mock.SignIDToken(stringVerified),
+			nonce:   "nonce",
+			wantErr: false,
+		},
+		{
+			name:    "Wrong nonce",
+			token:   mock.SignIDToken(mock.IDTokenClaims(identity, "other")),
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Expired",
+			token:   mock.SignIDToken(expired),
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "No expiry",
+			token:   mock.SignIDToken(noExpiry),
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong audience",
+			token:   mock.SignIDToken(wrongAudience),
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong issuer",
+			token:   mock.SignIDToken(wrongIssuer),
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name:    "Unsigned",
+			token:   "eyJhbGciOiJub25lIn0.eyJzdWIiOiJlbXBsb3llZS0xIn0.",
+			nonce:   "nonce",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenAfterKeyRotation(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	provider.keys.refreshInterval = 0
+	identity := oidctest.Identity{Subject: "employee-1"}
+
+	if _, err := provider.VerifyIDToken(context.Background(), mock.SignIDToken(mock.IDTokenClaims(identity, "nonce")), "nonce"); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	mock.RotateKey()
+	if _, err := provider.VerifyIDToken(context.Background(), mock.SignIDToken(mock.IDTokenClaims(identity, "nonce")), "nonce"); err != nil {
+		t.Errorf("VerifyIDToken() after rotation error = %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+// Package outbox publishes domain events reliably.
+//
+// Events are written to the outbox_events table in the same transaction as
+// the change they describe, so an event is recorded if and only if the
+// change is. A Relay then reads new events and hands them to subscribers
+// and sinks, marking them published once every one of them has accepted
+// the event.
+//
+// Delivery is at least once: an event is published again if a subscriber
+// fails, or if the relay stops between publishing it and marking it
+// published. Subscribers should treat events they have already seen, by
+// ID, as done.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/database"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultBatchSize    = 100
+
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// Event is something that happened to a user's data.
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	UserID    uuid.UUID       `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func eventFromDB(event database.OutboxEvent) Event {
+	return Event{
+		ID:        event.ID,
+		Type:      event.EventType,
+		UserID:    event.UserID,
+		CreatedAt: event.CreatedAt,
+		Payload:   event.Payload,
+	}
+}
+
+// Sink receives published events.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// SinkFunc lets a function be used as a Sink.
+type SinkFunc func(ctx context.Context, event Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// LogSink logs every event.
+func LogSink(logger *slog.Logger) Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		logger.InfoContext(ctx, "Event", "event_id", event.ID, "type", event.Type, "user_id", event.UserID, "payload", event.Payload)
+		return nil
+	})
+}
+
+// Write records an event. q should be bound to the transaction making the
+// change the event describes.
+func Write(ctx context.Context, q *database.Queries, eventType string, userID uuid.UUID, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("couldn't encode %s event: %w", eventType, err)
+	}
+	event, err := q.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{
+		EventType: eventType,
+		UserID:    userID,
+		Payload:   data,
+	})
+	if err != nil {
+		return Event{}, err
+	}
+	return eventFromDB(event), nil
+}
+
+// Relay publishes events from the outbox. Several servers can run one at
+// once; each event is locked by one of them while it's published.
+type Relay struct {
+	db          *sql.DB
+	subscribers map[string][]Sink
+	sinks       []Sink
+
+	PollInterval time.Duration
+	BatchSize    int32
+}
+
+func NewRelay(db *sql.DB) *Relay {
+	return &Relay{
+		db:           db,
+		subscribers:  map[string][]Sink{},
+		PollInterval: DefaultPollInterval,
+		BatchSize:    DefaultBatchSize,
+	}
+}
+
+// Subscribe has events of a type published to sink. It must be called
+// before the relay runs.
+func (r *Relay) Subscribe(eventType string, sink Sink) {
+	r.subscribers[eventType] = append(r.subscribers[eventType], sink)
+}
+
+// AddSink has every event published to sink. It must be called before the
+// relay runs.
+func (r *Relay) AddSink(sink Sink) {
+	r.sinks = append(r.sinks, sink)
+}
+
+// Run publishes events as they are written until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Couldn't relay outbox events", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes the events that are due, returning how many were
+// published.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		n, batchSize, err := r.relayBatch(ctx)
+		published += n
+		if err != nil || batchSize < int(r.BatchSize) {
+			return published, err
+		}
+	}
+}
+
+// relayBatch publishes a batch of events in one transaction, which keeps
+// them locked until they are marked. It returns how many were published
+// and how many were in the batch.
+func (r *Relay) relayBatch(ctx context.Context) (int, int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+
+	events, err := q.ListPendingOutboxEvents(ctx, r.BatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	published := 0
+	for _, dbEvent := range events {
+		event := eventFromDB(dbEvent)
+		if err := r.publish(ctx, event); err != nil {
+			slog.Error("Couldn't publish event", "type", event.Type, "event_id", event.ID, "error", err)
+			if err := q.RecordOutboxEventFailure(ctx, database.RecordOutboxEventFailureParams{
+				ID:            event.ID,
+				NextAttemptAt: time.Now().UTC().Add(retryDelay(dbEvent.Attempts + 1)),
+				LastError:     sql.NullString{String: err.Error(), Valid: true},
+			}); err != nil {
+				return 0, 0, err
+			}
+			continue
+		}
+		if err := q.MarkOutboxEventPublished(ctx, event.ID); err != nil {
+			return 0, 0, err
+		}
+		published++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return published, len(events), nil
+}
+
+// publish hands an event to its subscribers and every sink. All of them are
+// tried, so one failing doesn't hold up the others, but the event is
+// published to all of them again when it's retried.
+func (r *Relay) publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, sink := range slices.Concat(r.subscribers[event.Type], r.sinks) {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// retryDelay is how long to wait before publishing an event again after
+// attempts failures. It doubles with each failure, up to retryMaxDelay.
+func retryDelay(attempts int32) time.Duration {
+	delay := retryBaseDelay
+	for i := int32(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
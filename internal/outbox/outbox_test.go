@@ -0,0 +1,63 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 5, want: 16 * time.Second},
+		{attempts: 9, want: 256 * time.Second},
+		{attempts: 10, want: 5 * time.Minute},
+		{attempts: 100, want: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	r := NewRelay(nil)
+	var got []string
+	record := func(name string, err error) Sink {
+		return SinkFunc(func(ctx context.Context, event Event) error {
+			got = append(got, name+":"+event.Type)
+			return err
+		})
+	}
+	failure := errors.New("sink is down")
+	r.Subscribe("chirp.created", record("created", nil))
+	r.Subscribe("chirp.deleted", record("deleted", failure))
+	r.AddSink(record("all", nil))
+
+	ctx := context.Background()
+	if err := r.publish(ctx, Event{ID: uuid.New(), Type: "chirp.created"}); err != nil {
+		t.Errorf("publish() error = %v, wantErr %v", err, nil)
+	}
+	if err := r.publish(ctx, Event{ID: uuid.New(), Type: "chirp.deleted"}); !errors.Is(err, failure) {
+		t.Errorf("publish() error = %v, wantErr %v", err, failure)
+	}
+	want := []string{"created:chirp.created", "all:chirp.created", "deleted:chirp.deleted", "all:chirp.deleted"}
+	if len(got) != len(want) {
+		t.Fatalf("published to %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("published to %v, want %v", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package polkasim sends Chirpy the webhooks Polka would, so the Chirpy Red
+// flow can be exercised without Polka.
+//
+// Each scenario is a sequence of deliveries as Polka could make them for one
+// user, including the awkward ones: retries of an event that was already
+// delivered, events that arrive out of order and deliveries replayed long
+// after they were signed.
+package polkasim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+// Event is the body of a Polka webhook.
+type Event struct {
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Data  EventData `json:"data"`
+}
+
+type EventData struct {
+	UserID           string    `json:"user_id"`
+	Plan             string    `json:"plan,omitempty"`
+	CurrentPeriodEnd time.Time `json:"current_period_end,omitzero"`
+}
+
+// Delivery is one webhook request.
+type Delivery struct {
+	// Description says what the delivery simulates.
+	Description string
+	Event       Event
+	// SignedAt is when the delivery claims to have been signed.
+	SignedAt time.Time
+	// Expect is the status code Chirpy should respond with.
+	Expect int
+}
+
+type Scenario struct {
+	Name        string
+	Description string
+	Deliveries  func(userID string, now time.Time) []Delivery
+}
+
+// Scenarios are the sequences the simulator can send.
+var Scenarios = []Scenario{
+	{
+		Name:        "upgrade",
+		Description: "the user subscribes to Chirpy Red",
+		Deliveries: func(userID string, now time.Time) []Delivery {
+			return []Delivery{
+				deliver("subscribe", newEvent("user.upgraded", userID, now.AddDate(0, 1, 0)), now),
+			}
+		},
+	},
+	{
+		Name:        "lifecycle",
+		Description: "the user subscribes, renews twice with a failed payment in between, then downgrades",
+		Deliveries: func(userID string, now time.Time) []Delivery {
+			return []Delivery{
+				deliver("subscribe", newEvent("user.upgraded", userID, now.AddDate(0, 1, 0)), now),
+				deliver("first renewal", newEvent("user.renewed", userID, now.AddDate(0, 2, 0)), now),
+				deliver("payment fails", newEvent("user.payment_failed", userID, time.Time{}), now),
+				deliver("retried payment succeeds", newEvent("user.renewed", userID, now.AddDate(0, 3, 0)), now),
+				deliver("downgrade at period end", newEvent("user.downgraded", userID, time.Time{}), now),
+			}
+		},
+	},
+	{
+		Name:        "payment-failure",
+		Description: "the user subscribes and their next payment fails",
+		Deliveries: func(userID string, now time.Time) []Delivery {
+			return []Delivery{
+				deliver("subscribe", newEvent("user.upgraded", userID, now.AddDate(0, 1, 0)), now),
+				deliver("payment fails", newEvent("user.payment_failed", userID, time.Time{}), now),
+			}
+		},
+	},
+	{
+		Name:        "refund",
+		Description: "the user subscribes and is refunded",
+		Deliveries: func(userID string, now time.Time) []Delivery {
+			return []Delivery{
+				deliver("subscribe", newEvent("user.upgraded", userID, now.AddDate(0, 1, 0)), now),
+				deliver("refund", newEvent("user.refunded", userID, time.Time{}), now),
+			}
+		},
+	},
+	{
+		Name:        "duplicates",
+		Description: "Polka retries deliveries it already made",
+		Deliveries: func(userID string, now time.Time) []Delivery {
+			upgrade := newEvent("user.upgraded", userID, now.AddDate(0, 1, 0))
+			refund := newEvent("user.refunded", userID, time.Time{})
+			return []Delivery{
+				deliver("subscribe", upgrade, now),
+				deliver("retry of subscribe", upgrade, now.Add(time.Second)),
+				deliver("refund", refund, now),
+				deliver("retry of subscribe after the refund", upgrade, now.Add(2*time.Second)),
+				deliver("retry of refund", refund, now.Add(2*time.Second)),
+			}
+		},
+	},
+	{
+		Name:        "out-of-order",
+		Description: "events arrive in a different order than they happened",
+		Deliveries: func(userID string, now time.Time) []Delivery {
+			return []Delivery{
+				deliver("renewal before the subscription it renews", newEvent("user.renewed", userID, now.AddDate(0, 2, 0)), now),
+				deliver("late subscribe", newEvent("user.upgraded", userID, now.AddDate(0, 1, 0)), now),
+				deliver("downgrade before the failed payment", newEvent("user.downgraded", userID, time.Time{}), now),
+				deliver("late failed payment", newEvent("user.payment_failed", userID, time.Time{}), now),
+			}
+		},
+	},
+	{
+		Name:        "replay",
+		Description: "someone resends a delivery they captured an hour ago; Chirpy should reject it if it checks signatures",
+		Deliveries: func(userID string, now time.Time) []Delivery {
+			stale := deliver("captured delivery", newEvent("user.upgraded", userID, now.AddDate(0, 1, 0)), now.Add(-time.Hour))
+			stale.Expect = http.StatusUnauthorized
+			return []Delivery{stale}
+		},
+	},
+}
+
+// FindScenario returns the scenario called name.
+func FindScenario(name string) (Scenario, bool) {
+	for _, s := range Scenarios {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Scenario{}, false
+}
+
+func newEvent(eventType, userID string, periodEnd time.Time) Event {
+	id := make([]byte, 12)
+	rand.Read(id)
+	event := Event{
+		ID:    "evt_" + hex.EncodeToString(id),
+		Event: eventType,
+		Data:  EventData{UserID: userID},
+	}
+	if !periodEnd.IsZero() {
+		event.Data.Plan = "chirpy_red"
+		event.Data.CurrentPeriodEnd = periodEnd.UTC().Truncate(time.Second)
+	}
+	return event
+}
+
+func deliver(description string, event Event, signedAt time.Time) Delivery {
+	return Delivery{
+		Description: description,
+		Event:       event,
+		SignedAt:    signedAt,
+		Expect:      http.StatusNoContent,
+	}
+}
+
+// Client sends deliveries to a Chirpy server, authenticated like Polka: with
+// an Authorization header if APIKey is set, and a Polka-Signature header if
+// Secret is.
+type Client struct {
+	// BaseURL is the server's URL, such as http://localhost:8080.
+	BaseURL    string
+	APIKey     string
+	Secret     string
+	HTTPClient *http.Client
+}
+
+// Send makes a delivery and returns the status code Chirpy responded with.
+func (c *Client) Send(ctx context.Context, d Delivery) (int, error) {
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/api/polka/webhooks", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.APIKey)
+	}
+	if c.Secret != "" {
+		req.Header.Set("Polka-Signature", webhook.Sign(c.Secret, d.SignedAt, body))
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't deliver %s: %w", d.Event.ID, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,76 @@
+package polkasim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+func TestClientSend(t *testing.T) {
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/api/polka/webhooks" || r.Header.Get("Authorization") != "ApiKey test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := webhook.Verify("test-secret", r.Header.Get("Polka-Signature"), body, webhook.DefaultTolerance); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL + "/", APIKey: "test-key", Secret: "test-secret"}
+	now := time.Now()
+	for _, scenario := range Scenarios {
+		t.Run(scenario.Name, func(t *testing.T) {
+			received = nil
+			deliveries := scenario.Deliveries("3311741c-680c-4546-99f3-fc9efac2036c", now)
+			if len(deliveries) == 0 {
+				t.Fatalf("scenario has no deliveries")
+			}
+			for _, d := range deliveries {
+				status, err := client.Send(context.Background(), d)
+				if err != nil {
+					t.Fatalf("Send() error = %v", err)
+				}
+				if status != d.Expect {
+					t.Errorf("Send(%q) status = %d, want %d", d.Description, status, d.Expect)
+				}
+			}
+			for _, event := range received {
+				if event.ID == "" || event.Data.UserID != "3311741c-680c-4546-99f3-fc9efac2036c" {
+					t.Errorf("received event %+v, want an ID and the user's ID", event)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicatesReuseEventIDs(t *testing.T) {
+	scenario, ok := FindScenario("duplicates")
+	if !ok {
+		t.Fatalf("FindScenario(\"duplicates\") found nothing")
+	}
+	ids := map[string]int{}
+	for _, d := range scenario.Deliveries("user", time.Now()) {
+		ids[d.Event.ID]++
+	}
+	if len(ids) != 2 {
+		t.Errorf("deliveries have %d distinct event IDs, want 2", len(ids))
+	}
+}
@@ -0,0 +1,135 @@
+// Package scheduler runs maintenance tasks on intervals.
+//
+// Every server can run the same tasks. Before running one, a server takes a
+// Postgres advisory lock for it, so only one server runs it at a time, and
+// checks when any server last ran it, so it runs about once per interval
+// however many servers there are. Locks are released when their session
+// ends, so a server that stops while running a task doesn't hold it up.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/database"
+)
+
+// DefaultCheckInterval is how often a scheduler looks for tasks that are
+// due. Tasks can't run more often than this.
+const DefaultCheckInterval = time.Minute
+
+// Task is a function run every Interval.
+type Task struct {
+	// Name identifies the task across servers, so it must be unique and
+	// stay the same between versions.
+	Name     string
+	Interval time.Duration
+	Run      func(context.Context) error
+}
+
+type Scheduler struct {
+	db    *sql.DB
+	tasks []Task
+
+	CheckInterval time.Duration
+}
+
+func New(db *sql.DB, tasks ...Task) *Scheduler {
+	return &Scheduler{
+		db:            db,
+		tasks:         tasks,
+		CheckInterval: DefaultCheckInterval,
+	}
+}
+
+// Run runs tasks as they come due until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.CheckInterval)
+	defer ticker.Stop()
+	for {
+		s.RunDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs each task that is due and that no other server is running.
+func (s *Scheduler) RunDue(ctx context.Context) {
+	for _, task := range s.tasks {
+		if err := s.runIfDue(ctx, task); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Couldn't run scheduled task", "task", task.Name, "error", err)
+		}
+	}
+}
+
+func (s *Scheduler) runIfDue(ctx context.Context, task Task) error {
+	// Advisory locks belong to a session, so the lock is taken and
+	// released on a connection set aside for it.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	q := database.New(conn)
+
+	key := lockKey(task.Name)
+	locked, err := q.TryAdvisoryLock(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer func() {
+		if _, err := q.AdvisoryUnlock(context.WithoutCancel(ctx), key); err != nil {
+			slog.Error("Couldn't unlock scheduled task", "task", task.Name, "error", err)
+		}
+	}()
+
+	lastRun, err := q.GetScheduledTaskLastRun(ctx, task.Name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	now := time.Now().UTC()
+	if !due(lastRun, task.Interval, now) {
+		return nil
+	}
+
+	runErr := task.Run(ctx)
+	// Failed runs are recorded too, and retried next interval rather than
+	// on every check.
+	lastError := sql.NullString{}
+	if runErr != nil {
+		lastError = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	if err := q.RecordScheduledTaskRun(context.WithoutCancel(ctx), database.RecordScheduledTaskRunParams{
+		Name:      task.Name,
+		LastRunAt: now,
+		LastError: lastError,
+	}); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// due reports whether a task last run at lastRun should run again at now.
+// Tasks that have never run have a zero lastRun.
+func due(lastRun time.Time, interval time.Duration, now time.Time) bool {
+	return !now.Before(lastRun.Add(interval))
+}
+
+// lockKey is the advisory lock key for a task. Keys share a space with every
+// other advisory lock in the database, so they are derived from a prefix as
+// well as the name.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("chirpy/scheduler/" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDue(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		lastRun time.Time
+		want    bool
+	}{
+		{name: "Never run", lastRun: time.Time{}, want: true},
+		{name: "Ran an interval ago", lastRun: now.Add(-time.Hour), want: true},
+		{name: "Ran within the interval", lastRun: now.Add(-59 * time.Minute), want: false},
+		{name: "Ran in the future", lastRun: now.Add(time.Minute), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := due(tt.lastRun, time.Hour, now); got != tt.want {
+				t.Errorf("due(%v, 1h, %v) = %v, want %v", tt.lastRun, now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockKey(t *testing.T) {
+	if lockKey("purge_refresh_tokens") != lockKey("purge_refresh_tokens") {
+		t.Errorf("lockKey() isn't stable")
+	}
+	if lockKey("purge_refresh_tokens") == lockKey("purge_jobs") {
+		t.Errorf("lockKey() is the same for different tasks")
+	}
+}
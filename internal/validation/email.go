@@ -0,0 +1,39 @@
+package validation
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+const (
+	maxEmailLength      = 254
+	maxEmailLocalLength = 64
+)
+
+// NormalizeEmail checks that email is a bare RFC 5322 address, such as
+// "walt@example.com" but not "Walt <walt@example.com>", and returns it in
+// the lowercase form it should be stored and looked up by.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errors.New("email is required")
+	}
+	if len(email) > maxEmailLength {
+		return "", errors.New("email is too long")
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", errors.New("email is not a valid email address")
+	}
+
+	local, domain, _ := strings.Cut(address.Address, "@")
+	if len(local) > maxEmailLocalLength {
+		return "", errors.New("email is not a valid email address")
+	}
+	if !strings.Contains(strings.Trim(domain, "."), ".") {
+		return "", errors.New("email must include a full domain name")
+	}
+	return strings.ToLower(address.Address), nil
+}
@@ -0,0 +1,62 @@
+package validation
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]struct{} {
+	passwords := map[string]struct{}{}
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordList))
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			passwords[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	return passwords
+}()
+
+type PasswordPolicy struct {
+	// MinLength is counted in characters.
+	MinLength int
+	// MaxLength is counted in bytes, since that is what hashing cost
+	// depends on.
+	MaxLength int
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 128,
+	}
+}
+
+// Validate returns the reasons password is unacceptable for the account
+// with the given email, or an empty slice if there are none.
+func (p PasswordPolicy) Validate(password, email string) []string {
+	var problems []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("password must be at most %d bytes long", p.MaxLength))
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := commonPasswords[lower]; ok {
+		problems = append(problems, "password is too common")
+	}
+
+	email = strings.ToLower(email)
+	local, _, _ := strings.Cut(email, "@")
+	if email != "" && strings.Contains(lower, email) || len(local) >= 3 && strings.Contains(lower, local) {
+		problems = append(problems, "password must not contain your email address")
+	}
+	return problems
+}
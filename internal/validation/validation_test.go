@@ -0,0 +1,132 @@
+package validation
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		wantEmail string
+		wantErr   bool
+	}{
+		{
+			name:      "Valid email",
+			email:     "walt@example.com",
+			wantEmail: "walt@example.com",
+			wantErr:   false,
+		},
+		{
+			name:      "Mixed case is lowercased",
+			email:     "Walt.White@Example.COM",
+			wantEmail: "walt.white@example.com",
+			wantErr:   false,
+		},
+		{
+			name:      "Surrounding whitespace is trimmed",
+			email:     "  walt@example.com ",
+			wantEmail: "walt@example.com",
+			wantErr:   false,
+		},
+		{
+			name:      "Plus addressing",
+			email:     "walt+chirpy@example.com",
+			wantEmail: "walt+chirpy@example.com",
+			wantErr:   false,
+		},
+		{
+			name:    "Empty",
+			email:   "",
+			wantErr: true,
+		},
+		{
+			name:    "Missing at sign",
+			email:   "walt.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "Display name",
+			email:   "Walt <walt@example.com>",
+			wantErr: true,
+		},
+		{
+			name:    "Dotless domain",
+			email:   "walt@localhost",
+			wantErr: true,
+		},
+		{
+			name:    "Two addresses",
+			email:   "walt@example.com, jesse@example.com",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotEmail, err := NormalizeEmail(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NormalizeEmail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotEmail != tt.wantEmail {
+				t.Errorf("NormalizeEmail() = %s, want %s", gotEmail, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 16}
+
+	tests := []struct {
+		name         string
+		password     string
+		email        string
+		wantProblems int
+	}{
+		{
+			name:         "Acceptable password",
+			password:     "tread-lightly",
+			email:        "walt@example.com",
+			wantProblems: 0,
+		},
+		{
+			name:         "Empty password",
+			password:     "",
+			email:        "walt@example.com",
+			wantProblems: 1,
+		},
+		{
+			name:         "Too long",
+			password:     "say-my-name-heisenberg",
+			email:        "walt@example.com",
+			wantProblems: 1,
+		},
+		{
+			name:         "Common password in any case",
+			password:     "PassWord123",
+			email:        "walt@example.com",
+			wantProblems: 1,
+		},
+		{
+			name:         "Contains email local part",
+			password:     "xWALTx-1959",
+			email:        "walt@example.com",
+			wantProblems: 1,
+		},
+		{
+			name:         "Multibyte characters count as one",
+			password:     "ééééééé",
+			email:        "walt@example.com",
+			wantProblems: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := policy.Validate(tt.password, tt.email)
+			if len(problems) != tt.wantProblems {
+				t.Errorf("Validate() = %v, want %d problems", problems, tt.wantProblems)
+			}
+		})
+	}
+}
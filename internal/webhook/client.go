@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for deliveries to addresses on private
+// networks, which users mustn't be able to reach through the server.
+var ErrPrivateAddress = errors.New("webhook address is on a private network")
+
+// NewClient returns an HTTP client for delivering webhooks to URLs chosen by
+// users. Unless allowPrivate is set, it refuses to connect to loopback,
+// private and link-local addresses. The check happens when connecting, so
+// DNS names can't be rebound to such an address after being validated.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Proxies would connect on our behalf, bypassing the check.
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// Redirects could lead anywhere; receivers must answer directly.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// IsPublicAddr reports whether addr is reachable on the public internet.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		// Carrier-grade NAT, which IsPrivate doesn't cover.
+		!netip.MustParsePrefix("100.64.0.0/10").Contains(addr)
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Now()
+	// Signed with both the old and the new secret.
+	_, newSignature, _ := strings.Cut(Sign("secret", now, body), ",")
+	rotating := Sign("old_secret", now, body) + "," + newSignature
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:    "Valid signature",
+			header:  Sign("secret", now, body),
+			body:    body,
+			wantErr: nil,
+		},
+		{
+			name:    "Rotating secrets",
+			header:  rotating,
+			body:    body,
+			wantErr: nil,
+		},
+		{
+			name:    "Wrong secret",
+			header:  Sign("wrong_secret", now, body),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Tampered body",
+			header:  Sign("secret", now, body),
+			body:    []byte(`{"event":"user.downgraded"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Old delivery",
+			header:  Sign("secret", now.Add(-10*time.Minute), body),
+			body:    body,
+			wantErr: ErrTimestampTolerance,
+		},
+		{
+			name:    "Delivery from the future",
+			header:  Sign("secret", now.Add(10*time.Minute), body),
+			body:    body,
+			wantErr: ErrTimestampTolerance,
+		},
+		{
+			name:    "Missing header",
+			header:  "",
+			body:    body,
+			wantErr: ErrNoSignature,
+		},
+		{
+			name:    "Missing timestamp",
+			header:  "v1=" + computeSignature("secret", "", body),
+			body:    body,
+			wantErr: ErrNoSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify("secret", tt.header, tt.body, DefaultTolerance); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
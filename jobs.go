@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/jobs"
+	"github.com/gyulaieric/chirpy/internal/logging"
+)
+
+const (
+	defaultJobWorkers = 4
+	// jobRetention is how long finished jobs are kept for admins to see.
+	jobRetention  = 7 * 24 * time.Hour
+	maxJobsListed = 100
+)
+
+// registerJobs sets up the handlers for every kind of job.
+func (cfg *apiConfig) registerJobs() {
+	jobs.Handle(cfg.jobs, dataExportJob, cfg.runDataExport)
+}
+
+type Job struct {
+	Id          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Kind        string          `json:"kind"`
+	Args        json.RawMessage `json:"args"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+func jobFromDB(job database.Job) Job {
+	j := Job{
+		Id:          job.ID,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+		Kind:        job.Kind,
+		Args:        job.Args,
+		Status:      job.Status,
+		Attempts:    job.Attempts,
+		MaxAttempts: job.MaxAttempts,
+		RunAt:       job.RunAt,
+		UniqueKey:   job.UniqueKey.String,
+		LastError:   job.LastError.String,
+	}
+	if job.FinishedAt.Valid {
+		j.FinishedAt = &job.FinishedAt.Time
+	}
+	return j
+}
+
+func (cfg *apiConfig) handlerAdminListJobs() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		dbJobs, err := cfg.db.ListJobs(r.Context(), database.ListJobsParams{
+			Status:  sql.NullString{String: status, Valid: status != ""},
+			MaxJobs: maxJobsListed,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't list jobs", err)
+			return
+		}
+
+		list := []Job{}
+		for _, dbJob := range dbJobs {
+			list = append(list, jobFromDB(dbJob))
+		}
+		respondWithJSON(w, http.StatusOK, list)
+	})
+}
+
+func (cfg *apiConfig) handlerAdminGetJob() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(r.PathValue("jobID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid job ID", err)
+			return
+		}
+
+		job, err := cfg.db.GetJob(r.Context(), jobID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Job not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get job", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, jobFromDB(job))
+	})
+}
+
+// handlerAdminRetryJob queues a failed job to run again right away, with
+// all of its attempts. It can't while a job with the same unique key is
+// queued or running.
+func (cfg *apiConfig) handlerAdminRetryJob() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(r.PathValue("jobID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid job ID", err)
+			return
+		}
+
+		job, err := cfg.db.RequeueJob(r.Context(), jobID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "No failed job with that ID", err)
+			return
+		}
+		if isUniqueViolation(err) {
+			respondWithError(w, r, http.StatusConflict, "A job with the same unique key is already queued", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't retry job", err)
+			return
+		}
+		logging.FromContext(r.Context()).Info("Requeued job", "job_id", job.ID, "kind", job.Kind)
+		respondWithJSON(w, http.StatusOK, jobFromDB(job))
+	})
+}
+
+// purgeJobs deletes finished jobs past their retention period.
+func (cfg *apiConfig) purgeJobs(ctx context.Context) error {
+	deleted, err := cfg.db.DeleteJobsBefore(ctx, nullTime(time.Now().UTC().Add(-jobRetention)))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Deleted finished jobs", "count", deleted)
+	}
+	return nil
+}
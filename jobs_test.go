@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/jobs"
+)
+
+// waitForJob polls a job until it has status.
+func waitForJob(t *testing.T, cfg *apiConfig, id uuid.UUID, status string) Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, err := cfg.db.GetJob(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetJob() error = %v", err)
+		}
+		if job.Status == status {
+			return jobFromDB(job)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s status = %s, want %s", id, job.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	_, cfg := newTestServer(t)
+
+	q := jobs.New(cfg.db)
+	q.PollInterval = 10 * time.Millisecond
+	// The kinds are unique to this run, so no other queue claims them.
+	retried := jobs.Kind[string]{Name: "test_retried_" + uuid.NewString(), MaxAttempts: 2}
+	once := jobs.Kind[string]{Name: "test_once_" + uuid.NewString(), MaxAttempts: 1}
+	handle := func(ctx context.Context, arg string) error {
+		if arg == "fail" {
+			return errors.New("failed on purpose")
+		}
+		return nil
+	}
+	jobs.Handle(q, retried, handle)
+	jobs.Handle(q, once, handle)
+
+	ctx := context.Background()
+	succeeding, err := retried.Enqueue(ctx, q, "succeed", jobs.Options{UniqueKey: retried.Name})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if _, err := retried.Enqueue(ctx, q, "succeed", jobs.Options{UniqueKey: retried.Name}); !errors.Is(err, jobs.ErrDuplicate) {
+		t.Errorf("Enqueue() duplicate error = %v, wantErr %v", err, jobs.ErrDuplicate)
+	}
+	failing, _ := retried.Enqueue(ctx, q, "fail", jobs.Options{})
+	failed, _ := once.Enqueue(ctx, q, "fail", jobs.Options{})
+	later, _ := retried.Enqueue(ctx, q, "succeed", jobs.Options{RunAt: time.Now().Add(time.Hour)})
+
+	runCtx, stop := context.WithCancel(ctx)
+	drained := make(chan struct{})
+	go func() {
+		q.Run(runCtx, 2)
+		close(drained)
+	}()
+	defer func() {
+		stop()
+		<-drained
+	}()
+
+	if job := waitForJob(t, cfg, succeeding.ID, jobs.StatusSucceeded); job.Attempts != 1 || job.FinishedAt == nil {
+		t.Errorf("succeeded job = %+v, want it finished after one attempt", job)
+	}
+	// A failed attempt is retried later, until the job runs out of them.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, _ := cfg.db.GetJob(ctx, failing.ID)
+		if job.Attempts == 1 && job.Status == jobs.StatusQueued {
+			if !job.RunAt.After(time.Now().UTC()) || job.LastError.String != "failed on purpose" {
+				t.Errorf("failing job = %+v, want a later retry and the error", jobFromDB(job))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failing job = %+v, want it queued for a retry", jobFromDB(job))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitForJob(t, cfg, failed.ID, jobs.StatusFailed)
+	if job, _ := cfg.db.GetJob(ctx, later.ID); job.Status != jobs.StatusQueued || job.Attempts != 0 {
+		t.Errorf("scheduled job = %+v, want it left until it's due", jobFromDB(job))
+	}
+
+	var listed []Job
+	serveAdmin(t, cfg.handlerAdminListJobs(), http.MethodGet, "/admin/jobs?status=failed", nil, &listed)
+	found := false
+	for _, job := range listed {
+		found = found || job.Id == failed.ID
+	}
+	if !found {
+		t.Errorf("failed job %s isn't listed", failed.ID)
+	}
+	var requeued Job
+	if code := serveAdmin(t, cfg.handlerAdminRetryJob(), http.MethodPost, "/", map[string]string{"jobID": failed.ID.String()}, &requeued); code != http.StatusOK {
+		t.Fatalf("retry status = %d, want %d", code, http.StatusOK)
+	}
+	if requeued.Status != jobs.StatusQueued || requeued.Attempts != 0 {
+		t.Errorf("requeued job = %+v, want it queued with all its attempts", requeued)
+	}
+	if job := waitForJob(t, cfg, failed.ID, jobs.StatusFailed); job.Attempts != 1 {
+		t.Errorf("retried job = %+v, want it run again", job)
+	}
+	if code := serveAdmin(t, cfg.handlerAdminRetryJob(), http.MethodPost, "/", map[string]string{"jobID": succeeding.ID.String()}, nil); code != http.StatusNotFound {
+		t.Errorf("retry succeeded job status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	// A failed job can't be retried while another with its unique key is
+	// queued.
+	unique, _ := once.Enqueue(ctx, q, "fail", jobs.Options{UniqueKey: once.Name})
+	waitForJob(t, cfg, unique.ID, jobs.StatusFailed)
+	if _, err := once.Enqueue(ctx, q, "succeed", jobs.Options{UniqueKey: once.Name, RunAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if code := serveAdmin(t, cfg.handlerAdminRetryJob(), http.MethodPost, "/", map[string]string{"jobID": unique.ID.String()}, nil); code != http.StatusConflict {
+		t.Errorf("retry with a queued duplicate status = %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestJobLeaseGuard(t *testing.T) {
+	_, cfg := newTestServer(t)
+	ctx := context.Background()
+
+	q := jobs.New(cfg.db)
+	kind := jobs.Kind[string]{Name: "test_lease_" + uuid.NewString()}
+	job, err := kind.Enqueue(ctx, q, "", jobs.Options{})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	// The first worker's lease runs out, and a second worker claims the
+	// job.
+	claim := func(lockedUntil time.Time) database.Job {
+		t.Helper()
+		claimed, err := cfg.db.ClaimJob(ctx, database.ClaimJobParams{
+			LockedUntil: sql.NullTime{Time: lockedUntil, Valid: true},
+			Kinds:       []string{kind.Name},
+		})
+		if err != nil || claimed.ID != job.ID {
+			t.Fatalf("ClaimJob() = %v, %v, want job %s", claimed.ID, err, job.ID)
+		}
+		return claimed
+	}
+	first := claim(time.Now().UTC().Add(-time.Second))
+	second := claim(time.Now().UTC().Add(time.Minute))
+
+	if rows, err := cfg.db.FailJob(ctx, database.FailJobParams{
+		ID:          job.ID,
+		LastError:   sql.NullString{String: "too late", Valid: true},
+		LockedUntil: first.LockedUntil,
+	}); err != nil || rows != 0 {
+		t.Errorf("FailJob() with an expired lease = %d, %v, want no rows", rows, err)
+	}
+	if rows, err := cfg.db.CompleteJob(ctx, database.CompleteJobParams{ID: job.ID, LockedUntil: second.LockedUntil}); err != nil || rows != 1 {
+		t.Errorf("CompleteJob() with the current lease = %d, %v, want 1 row", rows, err)
+	}
+	if got, _ := cfg.db.GetJob(ctx, job.ID); got.Status != jobs.StatusSucceeded {
+		t.Errorf("job status = %s, want %s", got.Status, jobs.StatusSucceeded)
+	}
+}
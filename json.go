@@ -2,16 +2,21 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/validation"
 )
 
-func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
+// respondWithError sends msg to the client, and logs err with the request
+// it failed.
+func respondWithError(w http.ResponseWriter, r *http.Request, code int, msg string, err error) {
+	logger := logging.FromContext(r.Context())
 	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+		logger.Error("Responding with 5XX error", "status", code, "message", msg, "error", err)
+	} else if err != nil {
+		logger.Info("Responding with error", "status", code, "message", msg, "error", err)
 	}
 	type errorResponse struct {
 		Error string `json:"error"`
@@ -21,11 +26,22 @@ func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	})
 }
 
+func respondWithValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	type errorResponse struct {
+		Error  string                  `json:"error"`
+		Fields []validation.FieldError `json:"fields"`
+	}
+	respondWithJSON(w, http.StatusUnprocessableEntity, errorResponse{
+		Error:  "Invalid parameters",
+		Fields: errs,
+	})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Couldn't marshal JSON", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+)
+
+const (
+	loginMethodPassword  = "password"
+	loginMethodMFA       = "mfa"
+	loginMethodMagicLink = "magic_link"
+	loginMethodOIDC      = "oidc"
+	loginMethodOAuth     = "oauth"
+
+	loginFailureInvalidCredentials = "invalid_credentials"
+	loginFailureInvalidMFACode     = "invalid_mfa_code"
+	loginFailureLockedOut          = "locked_out"
+
+	loginHistoryLimit = 50
+	// maxUserAgentLength stops clients from filling the table with huge
+	// headers.
+	maxUserAgentLength = 512
+)
+
+// loginAttempt describes a login for the login history. userID is unset for
+// attempts on emails without an account, and failureReason is empty for
+// successful logins.
+type loginAttempt struct {
+	userID        uuid.NullUUID
+	email         string
+	method        string
+	failureReason string
+	// refreshToken is the session the login started, if any. Successful
+	// logins that start a session from a new device or network are reported
+	// to the account owner, with a link to revoke it. Only its hash is
+	// stored, so a leaked history can't be used to take over the session.
+	refreshToken string
+	// oauthClientID is the app an OAuth login granted access to. Its tokens
+	// are issued to the app later, so revoking the login revokes all of them.
+	oauthClientID string
+}
+
+// recordLoginAttempt adds a login to the history. Failing to do so is logged
+// rather than failing the login.
+func (cfg *apiConfig) recordLoginAttempt(r *http.Request, attempt loginAttempt) {
+	ip := cfg.clientIP(r)
+	network := clientNetwork(ip)
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	success := attempt.failureReason == ""
+
+	var familiarity database.GetLoginFamiliarityRow
+	if success && attempt.userID.Valid {
+		var err error
+		familiarity, err = cfg.db.GetLoginFamiliarity(r.Context(), database.GetLoginFamiliarityParams{
+			UserAgent: userAgent,
+			Network:   network,
+			UserID:    attempt.userID,
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Couldn't check login history", "user_id", attempt.userID.UUID, "error", err)
+			// Don't alert about every login just because this failed.
+			familiarity = database.GetLoginFamiliarityRow{KnownDevice: true, KnownNetwork: true}
+		}
+	}
+	// The first login of an account has nothing to compare against.
+	newDevice := familiarity.HasHistory && !familiarity.KnownDevice
+	newNetwork := familiarity.HasHistory && !familiarity.KnownNetwork
+	alert := (newDevice || newNetwork) && (attempt.refreshToken != "" || attempt.oauthClientID != "")
+
+	var revokeToken string
+	var revokeTokenHash sql.NullString
+	if alert {
+		revokeToken = auth.MakeSignedToken(cfg.jwtSecret)
+		revokeTokenHash = sql.NullString{String: auth.HashToken(revokeToken), Valid: true}
+	}
+	if err := cfg.db.CreateLoginEvent(r.Context(), database.CreateLoginEventParams{
+		UserID:           attempt.userID,
+		Email:            attempt.email,
+		Method:           attempt.method,
+		Success:          success,
+		FailureReason:    sql.NullString{String: attempt.failureReason, Valid: !success},
+		IpAddress:        ip,
+		Network:          network,
+		UserAgent:        userAgent,
+		NewDevice:        newDevice,
+		NewNetwork:       newNetwork,
+		RefreshTokenHash: sql.NullString{String: auth.HashToken(attempt.refreshToken), Valid: attempt.refreshToken != ""},
+		RevokeTokenHash:  revokeTokenHash,
+		OauthClientID:    sql.NullString{String: attempt.oauthClientID, Valid: attempt.oauthClientID != ""},
+	}); err != nil {
+		logging.FromContext(r.Context()).Error("Couldn't record login event", "error", err)
+		return
+	}
+
+	if alert {
+		cfg.sendNewLoginAlert(attempt, ip, userAgent, revokeToken)
+	}
+}
+
+func (cfg *apiConfig) sendNewLoginAlert(attempt loginAttempt, ip, userAgent, revokeToken string) {
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
+	link := cfg.baseURL + "/app/revoke-session.html?token=" + url.QueryEscape(revokeToken)
+	cfg.sendMail(mailer.Message{
+		To:      attempt.email,
+		Subject: "New sign-in to your Chirpy account",
+		Body: fmt.Sprintf(
+			"Your Chirpy account was just signed in to from a device or network we haven't seen before.\n\nTime: %s\nIP address: %s\nDevice: %s\nMethod: %s\n\nIf this was you, you can ignore this email. If it wasn't, sign that session out by opening the link below, then reset your password:\n\n%s\n",
+			time.Now().UTC().Format(time.RFC1123),
+			ip,
+			userAgent,
+			attempt.method,
+			link,
+		),
+	})
+}
+
+// recordLoginFailureForEmail records a failed login in the history of the
+// account it was aimed at, if there is one.
+func (cfg *apiConfig) recordLoginFailureForEmail(r *http.Request, email, method, reason string) {
+	attempt := loginAttempt{
+		email:         email,
+		method:        method,
+		failureReason: reason,
+	}
+	dbUser, err := cfg.db.GetUserByEmail(r.Context(), email)
+	if err == nil {
+		attempt.userID = uuid.NullUUID{UUID: dbUser.ID, Valid: true}
+		attempt.email = dbUser.Email
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		logging.FromContext(r.Context()).Error("Couldn't look up user for login event", "error", err)
+	}
+	cfg.recordLoginAttempt(r, attempt)
+}
+
+type LoginEvent struct {
+	Id            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Method        string    `json:"method"`
+	Success       bool      `json:"success"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	IPAddress     string    `json:"ip_address"`
+	UserAgent     string    `json:"user_agent"`
+	NewDevice     bool      `json:"new_device"`
+	NewNetwork    bool      `json:"new_network"`
+	SessionActive bool      `json:"session_active"`
+}
+
+func loginEventFromDB(event database.ListLoginEventsRow) LoginEvent {
+	return LoginEvent{
+		Id:            event.ID,
+		CreatedAt:     event.CreatedAt,
+		Method:        event.Method,
+		Success:       event.Success,
+		FailureReason: event.FailureReason.String,
+		IPAddress:     event.IpAddress,
+		UserAgent:     event.UserAgent,
+		NewDevice:     event.NewDevice,
+		NewNetwork:    event.NewNetwork,
+		SessionActive: event.SessionActive,
+	}
+}
+
+func (cfg *apiConfig) handlerLoginHistory() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		dbEvents, err := cfg.db.ListLoginEvents(r.Context(), database.ListLoginEventsParams{
+			UserID: uuid.NullUUID{UUID: userID, Valid: true},
+			Limit:  loginHistoryLimit,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get login history", err)
+			return
+		}
+
+		events := []LoginEvent{}
+		for _, dbEvent := range dbEvents {
+			events = append(events, loginEventFromDB(dbEvent))
+		}
+		respondWithJSON(w, http.StatusOK, events)
+	})
+}
+
+// handlerRevokeLoginSession signs out the session started by a login, using
+// the token from a new sign-in alert. The email is what authorizes this, as
+// whoever started the session may have the user's password.
+func (cfg *apiConfig) handlerRevokeLoginSession() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Token string `json:"token"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		if !auth.ValidSignedToken(cfg.jwtSecret, params.Token) {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid session link", nil)
+			return
+		}
+		event, err := cfg.db.GetLoginEventByRevokeToken(r.Context(), sql.NullString{
+			String: auth.HashToken(params.Token),
+			Valid:  true,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid session link", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke session", err)
+			return
+		}
+
+		// The session may already have ended on its own.
+		if event.RefreshTokenHash.Valid && event.UserID.Valid {
+			if err := cfg.db.RevokeRefreshTokenByHash(r.Context(), database.RevokeRefreshTokenByHashParams{
+				UserID:    event.UserID.UUID,
+				TokenHash: event.RefreshTokenHash.String,
+			}); err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke session", err)
+				return
+			}
+		}
+		if event.OauthClientID.Valid && event.UserID.Valid {
+			if err := cfg.revokeOAuthGrant(r.Context(), event.UserID.UUID, event.OauthClientID.String); err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke session", err)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// revokeOAuthGrant takes away an app's access to a user's account: its
+// refresh tokens, and any authorization codes it hasn't exchanged yet. Its
+// access tokens expire on their own.
+func (cfg *apiConfig) revokeOAuthGrant(ctx context.Context, userID uuid.UUID, clientID string) error {
+	return cfg.withTx(ctx, func(q *database.Queries) error {
+		if err := q.ExpireOAuthAuthorizationCodesForUser(ctx, database.ExpireOAuthAuthorizationCodesForUserParams{
+			UserID:   userID,
+			ClientID: clientID,
+		}); err != nil {
+			return err
+		}
+		return q.RevokeOAuthRefreshTokensForUser(ctx, database.RevokeOAuthRefreshTokensForUserParams{
+			UserID:   userID,
+			ClientID: sql.NullString{String: clientID, Valid: true},
+		})
+	})
+}
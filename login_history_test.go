@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+)
+
+func TestLoginHistoryAndNewSignInAlert(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	mail := make(chanMailer, 10)
+	cfg.mailer = mail
+
+	email := uuid.NewString() + "@example.com"
+	password := "correct horse battery staple"
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, nil)
+	<-mail // verification email
+
+	login := func(userAgent, password string) (User, int) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+		req, err := http.NewRequest(http.MethodPost, chirpy.URL+"/api/login", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Couldn't create request: %v", err)
+		}
+		req.Header.Set("User-Agent", userAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /api/login: %v", err)
+		}
+		defer resp.Body.Close()
+		var user User
+		json.NewDecoder(resp.Body).Decode(&user)
+		return user, resp.StatusCode
+	}
+	expectNoMail := func() {
+		t.Helper()
+		select {
+		case msg := <-mail:
+			t.Errorf("sent %q, want no email", msg.Subject)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	if _, code := login("laptop", "wrong password"); code != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	// Neither the first login nor later ones from the same device alert.
+	user, code := login("laptop", password)
+	if code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+	login("laptop", password)
+	expectNoMail()
+
+	phone, code := login("phone", password)
+	if code != http.StatusOK {
+		t.Fatalf("login from new device status = %d, want %d", code, http.StatusOK)
+	}
+	link := receiveLink(t, mail)
+	if link.Path != "/app/revoke-session.html" {
+		t.Errorf("alert links to %s, want the revoke session page", link.Path)
+	}
+	token := link.Query().Get("token")
+
+	var history []LoginEvent
+	if code := doJSON(t, http.MethodGet, chirpy.URL+"/api/users/me/login-history", user.Token, nil, &history); code != http.StatusOK {
+		t.Fatalf("login history status = %d, want %d", code, http.StatusOK)
+	}
+	if len(history) != 4 {
+		t.Fatalf("login history has %d events, want 4", len(history))
+	}
+	if latest := history[0]; !latest.Success || !latest.NewDevice || latest.UserAgent != "phone" || !latest.SessionActive {
+		t.Errorf("latest event = %+v, want an active login from a new device", latest)
+	}
+	if first := history[3]; first.Success || first.FailureReason != loginFailureInvalidCredentials {
+		t.Errorf("first event = %+v, want a failure with %q", first, loginFailureInvalidCredentials)
+	}
+
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login-history/revoke", "", map[string]string{
+		"token": token,
+	}, nil); code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/refresh", phone.RefreshToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("refresh of revoked session status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/refresh", user.RefreshToken, nil, nil); code != http.StatusOK {
+		t.Errorf("refresh of other session status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestOAuthLoginAlert(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	user, credentials := createTestUser(t, chirpy.URL)
+	mail := make(chanMailer, 10)
+	cfg.mailer = mail
+
+	client := newFakeOAuthClient(t, chirpy.URL)
+	var registered OAuthClient
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/oauth/clients", user.Token, map[string]any{
+		"name":          "Fake client",
+		"redirect_uris": []string{client.redirectURI()},
+		"confidential":  true,
+	}, &registered); code != http.StatusCreated {
+		t.Fatalf("register client status = %d, want %d", code, http.StatusCreated)
+	}
+	client.id = registered.ClientID
+	client.secret = registered.ClientSecret
+
+	// The user grants the app access from a device they haven't logged in
+	// from before.
+	consent, _ := url.Parse(client.authorizeURL(auth.ScopeChirpsRead))
+	form := consent.Query()
+	form.Set("email", credentials["email"])
+	form.Set("password", credentials["password"])
+	form.Set("decision", "allow")
+	req, err := http.NewRequest(http.MethodPost, chirpy.URL+"/oauth/authorize", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "phone")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /oauth/authorize: %v", err)
+	}
+	resp.Body.Close()
+	tokens := <-client.tokens
+	if tokens.RefreshToken == "" {
+		t.Fatalf("token exchange = %+v, want tokens", tokens)
+	}
+
+	token := receiveLink(t, mail).Query().Get("token")
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login-history/revoke", "", map[string]string{
+		"token": token,
+	}, nil); code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d, want %d", code, http.StatusNoContent)
+	}
+	if refreshed := client.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	}); refreshed.Error != "invalid_grant" {
+		t.Errorf("refresh after revoking the login error = %q, want invalid_grant", refreshed.Error)
+	}
+
+	var history []LoginEvent
+	doJSON(t, http.MethodGet, chirpy.URL+"/api/users/me/login-history", user.Token, nil, &history)
+	if len(history) == 0 || history[0].Method != loginMethodOAuth || !history[0].NewDevice || history[0].SessionActive {
+		t.Errorf("login history = %+v, want the OAuth login first, signed out", history)
+	}
+}
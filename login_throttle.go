@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/lockout"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+)
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockout returns how much longer login attempts for email or from ip
+// are locked out, or 0 if they aren't.
+func (cfg *apiConfig) loginLockout(ctx context.Context, email, ip string) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range []string{accountThrottleKey(email), ipThrottleKey(ip)} {
+		throttle, err := cfg.db.GetActiveLockout(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		longest = max(longest, time.Until(throttle.LockedUntil.Time))
+	}
+	return longest, nil
+}
+
+// recordLoginFailure counts a failed attempt against both the account and
+// the client IP, locking them out once their policy says so. The owner of an
+// existing account is emailed when it first gets locked.
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, email, ip string) error {
+	accountLocked, err := cfg.recordThrottleFailure(ctx, accountThrottleKey(email), cfg.accountLockout)
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.recordThrottleFailure(ctx, ipThrottleKey(ip), cfg.ipLockout); err != nil {
+		return err
+	}
+
+	if accountLocked {
+		dbUser, err := cfg.db.GetUserByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cfg.sendMail(mailer.Message{
+			To:      dbUser.Email,
+			Subject: "Your Chirpy account has been temporarily locked",
+			Body: fmt.Sprintf(
+				"We've temporarily locked logins to your Chirpy account after %d failed attempts, the last one from %s.\n\nIf this wasn't you, someone may be trying to guess your password. Consider resetting it at %s/app/forgot-password.html.\n",
+				cfg.accountLockout.MaxAttempts,
+				ip,
+				cfg.baseURL,
+			),
+		})
+	}
+	return nil
+}
+
+// recordThrottleFailure reports whether this failure is the one that first
+// locked key in the current window.
+func (cfg *apiConfig) recordThrottleFailure(ctx context.Context, key string, policy lockout.Policy) (bool, error) {
+	throttle, err := cfg.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		WindowStart: time.Now().UTC().Add(-policy.Window),
+	})
+	if err != nil {
+		return false, err
+	}
+	delay := policy.Delay(int(throttle.Failures))
+	if delay == 0 {
+		return false, nil
+	}
+	if err := cfg.db.LockLogin(ctx, database.LockLoginParams{
+		Key:         key,
+		LockedUntil: sql.NullTime{Time: time.Now().UTC().Add(delay), Valid: true},
+	}); err != nil {
+		return false, err
+	}
+	return int(throttle.Failures) == policy.MaxAttempts, nil
+}
+
+func (cfg *apiConfig) clearAccountThrottle(ctx context.Context, email string) {
+	if _, err := cfg.db.ClearLoginThrottle(ctx, accountThrottleKey(email)); err != nil {
+		logging.FromContext(ctx).Error("Couldn't clear login throttle", "email", email, "error", err)
+	}
+}
+
+// reauthenticate checks the password a signed-in user gave to confirm a
+// sensitive change, responding and returning false unless it's correct.
+// Wrong passwords count towards the login lockout, or a stolen access token
+// would allow guessing the password without limit. Callers clear the
+// throttle once the whole change is confirmed, so a correct password
+// doesn't reset failures at a second factor checked after it.
+func (cfg *apiConfig) reauthenticate(w http.ResponseWriter, r *http.Request, dbUser database.User, password string) bool {
+	ip := cfg.clientIP(r)
+	retryAfter, err := cfg.loginLockout(r.Context(), dbUser.Email, ip)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't check login lockout", err)
+		return false
+	}
+	if retryAfter > 0 {
+		respondWithLockout(w, r, retryAfter)
+		return false
+	}
+
+	match, err := auth.CheckPasswordHash(password, dbUser.HashedPassword)
+	if err != nil || !match {
+		if err := cfg.recordLoginFailure(r.Context(), dbUser.Email, ip); err != nil {
+			logging.FromContext(r.Context()).Error("Couldn't record failed login", "error", err)
+		}
+		// Users created through single sign-on have a password nobody
+		// knows until they set one.
+		respondWithError(w, r, http.StatusUnauthorized, "Incorrect password. If you sign in through single sign-on and have never set a password, set one through a password reset first", err)
+		return false
+	}
+	return true
+}
+
+func respondWithLockout(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	respondWithError(w, r, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+}
+
+func (cfg *apiConfig) handlerClearLockout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Email string `json:"email"`
+			IP    string `json:"ip"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+		if params.Email == "" && params.IP == "" {
+			respondWithError(w, r, http.StatusBadRequest, "Provide an email or an IP to unlock", nil)
+			return
+		}
+
+		var keys []string
+		if params.Email != "" {
+			keys = append(keys, accountThrottleKey(params.Email))
+		}
+		if params.IP != "" {
+			keys = append(keys, ipThrottleKey(params.IP))
+		}
+		var cleared int64
+		for _, key := range keys {
+			rows, err := cfg.db.ClearLoginThrottle(r.Context(), key)
+			if err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't clear lockout", err)
+				return
+			}
+			cleared += rows
+		}
+		if cleared == 0 {
+			respondWithError(w, r, http.StatusNotFound, "No lockout found", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+)
+
+func TestMFALoginLockout(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	cfg.accountLockout.MaxAttempts = 2
+	user, credentials := createTestUser(t, chirpy.URL)
+
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/users/me/mfa", user.Token, nil, &enrollment); code != http.StatusCreated {
+		t.Fatalf("enroll status = %d, want %d", code, http.StatusCreated)
+	}
+	code, err := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatalf("TOTPCode() error = %v", err)
+	}
+	if status := doJSON(t, http.MethodPost, chirpy.URL+"/api/users/me/mfa/confirm", user.Token, map[string]string{"code": code}, nil); status != http.StatusOK {
+		t.Fatalf("confirm status = %d, want %d", status, http.StatusOK)
+	}
+
+	// A correct password between wrong codes doesn't reset the failures.
+	guess := func() int {
+		t.Helper()
+		var challenge struct {
+			MFAToken string `json:"mfa_token"`
+		}
+		if status := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &challenge); status != http.StatusOK {
+			t.Fatalf("login status = %d, want %d", status, http.StatusOK)
+		}
+		return doJSON(t, http.MethodPost, chirpy.URL+"/api/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": "000000"}, nil)
+	}
+	for range cfg.accountLockout.MaxAttempts {
+		if status := guess(); status != http.StatusUnauthorized {
+			t.Fatalf("wrong code status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	}
+	if status := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, nil); status != http.StatusTooManyRequests {
+		t.Errorf("login after %d wrong codes status = %d, want %d", cfg.accountLockout.MaxAttempts, status, http.StatusTooManyRequests)
+	}
+}
+
+func TestReauthenticationLockout(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	cfg.accountLockout.MaxAttempts = 2
+	user, credentials := createTestUser(t, chirpy.URL)
+
+	// Wrong passwords given to confirm a deletion count towards the login
+	// lockout, and so does the right one once it has kicked in.
+	for range cfg.accountLockout.MaxAttempts {
+		if status := doJSON(t, http.MethodDelete, chirpy.URL+"/api/users/me", user.Token, map[string]string{"password": "wrong password"}, nil); status != http.StatusUnauthorized {
+			t.Fatalf("delete with wrong password status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	}
+	if status := doJSON(t, http.MethodDelete, chirpy.URL+"/api/users/me", user.Token, map[string]string{"password": credentials["password"]}, nil); status != http.StatusTooManyRequests {
+		t.Errorf("delete after %d wrong passwords status = %d, want %d", cfg.accountLockout.MaxAttempts, status, http.StatusTooManyRequests)
+	}
+	if status := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, nil); status != http.StatusTooManyRequests {
+		t.Errorf("login after %d wrong passwords status = %d, want %d", cfg.accountLockout.MaxAttempts, status, http.StatusTooManyRequests)
+	}
+}
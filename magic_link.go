@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+)
+
+const (
+	magicLinkLifetime = 15 * time.Minute
+	// magicLinkMaxPerWindow limits how many links one account can be sent,
+	// so the endpoint can't be used to flood someone's inbox.
+	magicLinkMaxPerWindow = 3
+	magicLinkWindow       = time.Hour
+)
+
+func (cfg *apiConfig) handlerRequestMagicLink() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Email string `json:"email"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		// Respond the same way whether or not the account exists, and
+		// whether or not it has hit the rate limit, so this endpoint can't be
+		// used to find out who has an account.
+		dbUser, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Couldn't look up user for magic link", "error", err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		sent, err := cfg.db.CountMagicLinkTokensSince(r.Context(), database.CountMagicLinkTokensSinceParams{
+			UserID:    dbUser.ID,
+			CreatedAt: time.Now().UTC().Add(-magicLinkWindow),
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create magic link", err)
+			return
+		}
+		if sent >= magicLinkMaxPerWindow {
+			logging.FromContext(r.Context()).Info("Not sending magic link: rate limit reached", "user_id", dbUser.ID)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		token := auth.MakeSignedToken(cfg.jwtSecret)
+		if err := cfg.db.CreateMagicLinkToken(r.Context(), database.CreateMagicLinkTokenParams{
+			TokenHash: auth.HashToken(token),
+			UserID:    dbUser.ID,
+			Email:     dbUser.Email,
+			ExpiresAt: time.Now().UTC().Add(magicLinkLifetime),
+		}); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create magic link", err)
+			return
+		}
+
+		// The link opens a page that redeems the token with a POST, so that
+		// mail scanners following links don't use it up.
+		link := cfg.baseURL + "/app/magic-login.html?token=" + url.QueryEscape(token)
+		cfg.sendMail(mailer.Message{
+			To:      dbUser.Email,
+			Subject: "Your Chirpy login link",
+			Body: fmt.Sprintf(
+				"Open the link below to log in to Chirpy:\n\n%s\n\nThe link expires in 15 minutes and can only be used once. If you didn't ask for it, you can ignore this email.\n",
+				link,
+			),
+		})
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func (cfg *apiConfig) handlerRedeemMagicLink() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Token      string `json:"token"`
+			UseCookies bool   `json:"use_cookies"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		if !auth.ValidSignedToken(cfg.jwtSecret, params.Token) {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid or expired login link", nil)
+			return
+		}
+		magicLink, err := cfg.db.UseMagicLinkToken(r.Context(), auth.HashToken(params.Token))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid or expired login link", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't log in", err)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserById(r.Context(), magicLink.UserID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't log in", err)
+			return
+		}
+		// Links sent to an address the account no longer uses are void.
+		if dbUser.Email != magicLink.Email {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid or expired login link", nil)
+			return
+		}
+
+		// Opening the link proves the user owns the address.
+		if !dbUser.EmailVerifiedAt.Valid {
+			if _, err := cfg.db.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+				ID:    dbUser.ID,
+				Email: dbUser.Email,
+			}); err != nil {
+				logging.FromContext(r.Context()).Error("Couldn't mark email verified", "user_id", dbUser.ID, "error", err)
+			} else {
+				dbUser.EmailVerifiedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+			}
+		}
+
+		mfaEnabled, err := cfg.mfaEnabled(r.Context(), dbUser.ID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't check two-factor authentication", err)
+			return
+		}
+		if mfaEnabled {
+			cfg.respondWithMFAChallenge(w, r, dbUser)
+			return
+		}
+		cfg.respondWithTokens(w, r, dbUser, loginMethodMagicLink, params.UseCookies)
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func receiveMagicLinkToken(t *testing.T, mail chanMailer) string {
+	t.Helper()
+	return receiveLink(t, mail).Query().Get("token")
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	mail := make(chanMailer, 10)
+	cfg.mailer = mail
+
+	email := uuid.NewString() + "@example.com"
+	var registered User
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", map[string]string{
+		"email":    email,
+		"password": "correct horse battery staple",
+	}, &registered)
+	<-mail // verification email
+
+	// Unknown addresses get the same response, but no email.
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login/magic", "", map[string]string{
+		"email": uuid.NewString() + "@example.com",
+	}, nil); code != http.StatusAccepted {
+		t.Errorf("request for unknown email status = %d, want %d", code, http.StatusAccepted)
+	}
+
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login/magic", "", map[string]string{
+		"email": email,
+	}, nil); code != http.StatusAccepted {
+		t.Fatalf("request status = %d, want %d", code, http.StatusAccepted)
+	}
+	link := receiveLink(t, mail)
+	token := link.Query().Get("token")
+
+	// The link opens a page that redeems the token when the user asks.
+	resp, err := http.Get(chirpy.URL + link.RequestURI())
+	if err != nil {
+		t.Fatalf("GET %s: %v", link.Path, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("GET %s = %d %s, want an HTML page", link.Path, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login/magic/redeem", "", map[string]string{
+		"token": token,
+	}, &user); code != http.StatusOK {
+		t.Fatalf("redeem status = %d, want %d", code, http.StatusOK)
+	}
+	if user.Id != registered.Id || user.Token == "" || user.RefreshToken == "" || !user.EmailVerified {
+		t.Errorf("redeem = %+v, want tokens for a verified %v", user, registered.Id)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login/magic/redeem", "", map[string]string{
+		"token": token,
+	}, nil); code != http.StatusUnauthorized {
+		t.Errorf("second redeem status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// Past the rate limit, requests still look successful but send nothing.
+	for range magicLinkMaxPerWindow {
+		doJSON(t, http.MethodPost, chirpy.URL+"/api/login/magic", "", map[string]string{
+			"email": email,
+		}, nil)
+	}
+	for range magicLinkMaxPerWindow - 1 {
+		receiveMagicLinkToken(t, mail)
+	}
+	select {
+	case msg := <-mail:
+		t.Errorf("sent %q past the rate limit", msg.Subject)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
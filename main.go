@@ -1,13 +1,30 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/alexedwards/argon2id"
+	"github.com/gyulaieric/chirpy/internal/auth"
 	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/jobs"
+	"github.com/gyulaieric/chirpy/internal/lockout"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+	"github.com/gyulaieric/chirpy/internal/oidc"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+	"github.com/gyulaieric/chirpy/internal/scheduler"
+	"github.com/gyulaieric/chirpy/internal/validation"
+	"github.com/gyulaieric/chirpy/internal/webhook"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -15,90 +32,180 @@ import (
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
-	jwtSecret      string
-	platform       string
-	polkaKey       string
+	// sqlDB is the connection pool behind db, for starting transactions.
+	sqlDB     *sql.DB
+	jwtSecret string
+	platform  string
+	polkaKey  string
+	mailer    mailer.Mailer
+	baseURL   string
+	// requireEmailVerification blocks users from chirping until they
+	// have verified their email address.
+	requireEmailVerification bool
+	passwordPolicy           validation.PasswordPolicy
+	accountLockout           lockout.Policy
+	ipLockout                lockout.Policy
+	// trustProxyHeaders makes clientIP honor X-Forwarded-For. Only enable
+	// it behind a reverse proxy that sets that header.
+	trustProxyHeaders bool
+	// oidc is the identity provider users can sign in with, or nil if
+	// single sign-on isn't configured.
+	oidc *oidc.Provider
+	// accountDeletionGracePeriod is how long deleted accounts can still be
+	// restored by logging in.
+	accountDeletionGracePeriod time.Duration
+	// polkaWebhookSecret verifies the signatures on Polka's webhooks. When
+	// it's empty, webhooks are authenticated with polkaKey instead.
+	polkaWebhookSecret    string
+	polkaWebhookTolerance time.Duration
+	// webhookClient sends deliveries to users' webhook endpoints.
+	webhookClient *http.Client
+	jobs          *jobs.Queue
+	// relay publishes domain events from the outbox to their subscribers.
+	relay *outbox.Relay
 }
 
+// shutdownTimeout is how long in-flight requests get to finish when the
+// server is stopped.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	if err := godotenv.Load(); err != nil {
-		log.Printf("Couldn't load .env: %v", err)
-		os.Exit(1)
+		fatal("Couldn't load .env", "error", err)
+	}
+
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
 	}
 
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		log.Fatal("DB_URL must be set")
+	logFormat := os.Getenv("LOG_FORMAT")
+	if logFormat == "" {
+		logFormat = logging.FormatText
 	}
-	db, err := sql.Open("postgres", dbURL)
+	logHandler, err := logging.NewHandler(os.Stderr, logFormat)
 	if err != nil {
-		log.Printf(`Couldn't connect to database at "%s": %v`, dbURL, err)
+		fatal("Couldn't configure logging", "error", err)
 	}
+	slog.SetDefault(slog.New(logHandler))
+
+	db := openDB()
 
 	platform := os.Getenv("PLATFORM")
 	if platform == "" {
-		log.Fatal("PLATFORM must be set")
+		fatal("PLATFORM must be set")
 	}
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+		fatal("JWT_SECRET environment variable is not set")
 	}
 
 	polkaKey := os.Getenv("POLKA_KEY")
-	if polkaKey == "" {
-		log.Fatal("POLKA_KEY environment variable is not set")
-	}
-
-	apiCfg := apiConfig{
-		db:        database.New(db),
-		jwtSecret: jwtSecret,
-		platform:  platform,
-		polkaKey:  polkaKey,
+	polkaWebhookSecret := os.Getenv("POLKA_WEBHOOK_SECRET")
+	if polkaKey == "" && polkaWebhookSecret == "" {
+		fatal("POLKA_KEY or POLKA_WEBHOOK_SECRET must be set")
 	}
 
 	port := "8080"
-	filepathRoot := http.Dir(".")
 
-	mux := http.NewServeMux()
-
-	// API
-	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
 
-	mux.Handle("POST /api/users", apiCfg.handlerRegister())
-	mux.Handle("PUT /api/users", apiCfg.handlerUpdateUsers())
+	mailSender, err := mailerFromEnv()
+	if err != nil {
+		fatal("Couldn't configure mailer", "error", err)
+	}
 
-	mux.Handle("POST /api/login", apiCfg.handlerLogin())
+	oidcProvider, err := oidcProviderFromEnv(context.Background(), strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		fatal("Couldn't configure OpenID Connect", "error", err)
+	}
 
-	mux.Handle("POST /api/refresh", apiCfg.handlerRefresh())
-	mux.Handle("POST /api/revoke", apiCfg.handlerRevoke())
+	passwordParams := *argon2id.DefaultParams
+	passwordParams.Memory = uint32(envInt("ARGON2_MEMORY", int(passwordParams.Memory)))
+	passwordParams.Iterations = uint32(envInt("ARGON2_ITERATIONS", int(passwordParams.Iterations)))
+	passwordParams.Parallelism = uint8(envInt("ARGON2_PARALLELISM", int(passwordParams.Parallelism)))
+	passwordParams.SaltLength = uint32(envInt("ARGON2_SALT_LENGTH", int(passwordParams.SaltLength)))
+	passwordParams.KeyLength = uint32(envInt("ARGON2_KEY_LENGTH", int(passwordParams.KeyLength)))
+	auth.SetPasswordParams(passwordParams)
+
+	passwordPolicy := validation.DefaultPasswordPolicy()
+	passwordPolicy.MinLength = envInt("PASSWORD_MIN_LENGTH", passwordPolicy.MinLength)
+	passwordPolicy.MaxLength = envInt("PASSWORD_MAX_LENGTH", passwordPolicy.MaxLength)
+
+	accountLockout := lockout.DefaultAccountPolicy()
+	accountLockout.MaxAttempts = envInt("LOGIN_MAX_ATTEMPTS", accountLockout.MaxAttempts)
+	ipLockout := lockout.DefaultIPPolicy()
+	ipLockout.MaxAttempts = envInt("LOGIN_MAX_ATTEMPTS_PER_IP", ipLockout.MaxAttempts)
+	for _, policy := range []*lockout.Policy{&accountLockout, &ipLockout} {
+		policy.BaseDelay = envDuration("LOGIN_LOCKOUT_BASE", policy.BaseDelay)
+		policy.MaxDelay = envDuration("LOGIN_LOCKOUT_MAX", policy.MaxDelay)
+		policy.Window = envDuration("LOGIN_FAILURE_WINDOW", policy.Window)
+	}
 
-	mux.Handle("GET /api/chirps", apiCfg.handlerGetChirps())
-	mux.Handle("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp())
-	mux.Handle("POST /api/chirps", apiCfg.handlerCreateChirp())
-	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp())
+	queries := database.New(db)
+	apiCfg := apiConfig{
+		db:                         queries,
+		sqlDB:                      db,
+		jwtSecret:                  jwtSecret,
+		platform:                   platform,
+		polkaKey:                   polkaKey,
+		mailer:                     mailSender,
+		baseURL:                    strings.TrimSuffix(baseURL, "/"),
+		requireEmailVerification:   os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
+		passwordPolicy:             passwordPolicy,
+		accountLockout:             accountLockout,
+		ipLockout:                  ipLockout,
+		trustProxyHeaders:          os.Getenv("TRUST_PROXY_HEADERS") == "true",
+		oidc:                       oidcProvider,
+		accountDeletionGracePeriod: envDuration("ACCOUNT_DELETION_GRACE_PERIOD", defaultAccountDeletionGracePeriod),
+		polkaWebhookSecret:         polkaWebhookSecret,
+		polkaWebhookTolerance:      envDuration("POLKA_WEBHOOK_TOLERANCE", webhook.DefaultTolerance),
+		webhookClient:              webhook.NewClient(webhookDeliveryTimeout, os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"),
+		jobs:                       jobs.New(queries),
+		relay:                      outbox.NewRelay(db),
+	}
+	apiCfg.registerJobs()
+	apiCfg.registerEventSubscribers()
+	if os.Getenv("OUTBOX_LOG_EVENTS") == "true" {
+		apiCfg.relay.AddSink(outbox.LogSink(slog.Default()))
+	}
 
-	mux.Handle("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhooks())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// ADMIN
-	mux.Handle("POST /admin/reset", apiCfg.handlerReset())
-	mux.Handle("GET /admin/metrics", apiCfg.handlerMetrics())
+	jobsDrained := make(chan struct{})
+	go func() {
+		apiCfg.jobs.Run(ctx, envInt("JOB_WORKERS", defaultJobWorkers))
+		close(jobsDrained)
+	}()
+	go scheduler.New(db, apiCfg.maintenanceTasks()...).Run(ctx)
+	go apiCfg.relay.Run(ctx)
+	go apiCfg.runWebhookDispatcher(ctx, webhookDispatchInterval)
 
-	// File Server
-	mux.Handle(
-		"/app/",
-		apiCfg.middlewareMetricsInc(
-			http.StripPrefix(
-				"/app",
-				http.FileServer(filepathRoot),
-			),
-		),
-	)
+	filepathRoot := http.Dir(".")
 
 	server := http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: apiCfg.routes(filepathRoot),
+	}
+	go func() {
+		slog.Info("Serving files", "root", filepathRoot, "port", port)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			fatal("Couldn't serve", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Couldn't finish in-flight requests", "error", err)
 	}
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(server.ListenAndServe())
+	// Running jobs are bounded by their timeouts.
+	<-jobsDrained
 }
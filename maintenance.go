@@ -0,0 +1,25 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/scheduler"
+)
+
+const maintenanceInterval = time.Hour
+
+// maintenanceTasks delete data that has outlived its retention period, and
+// end subscriptions that have lapsed.
+func (cfg *apiConfig) maintenanceTasks() []scheduler.Task {
+	return []scheduler.Task{
+		{Name: "purge_deactivated_users", Interval: maintenanceInterval, Run: cfg.purgeDeactivatedUsers},
+		{Name: "purge_expired_data_exports", Interval: maintenanceInterval, Run: cfg.purgeExpiredDataExports},
+		{Name: "purge_refresh_tokens", Interval: maintenanceInterval, Run: cfg.purgeRefreshTokens},
+		{Name: "purge_polka_events", Interval: maintenanceInterval, Run: cfg.purgePolkaEvents},
+		{Name: "purge_webhook_events", Interval: maintenanceInterval, Run: cfg.purgeWebhookEvents},
+		{Name: "purge_webhook_deliveries", Interval: maintenanceInterval, Run: cfg.purgeWebhookDeliveries},
+		{Name: "purge_outbox_events", Interval: maintenanceInterval, Run: cfg.purgeOutboxEvents},
+		{Name: "purge_jobs", Interval: maintenanceInterval, Run: cfg.purgeJobs},
+		{Name: "expire_subscriptions", Interval: maintenanceInterval, Run: cfg.expireSubscriptions},
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/scheduler"
+)
+
+func TestSchedulerRunsTasksOnce(t *testing.T) {
+	db := openTestDB(t)
+
+	var runs atomic.Int32
+	task := scheduler.Task{
+		// The name is unique to this run, so earlier runs don't count.
+		Name:     "test_" + uuid.NewString(),
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			// Hold the lock long enough for the other servers to find it.
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	}
+
+	// Each scheduler stands in for a server.
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() { scheduler.New(db, task).RunDue(context.Background()) })
+	}
+	wg.Wait()
+	scheduler.New(db, task).RunDue(context.Background())
+
+	if got := runs.Load(); got != 1 {
+		t.Errorf("task ran %d times, want 1", got)
+	}
+}
+
+func TestPurgeRefreshTokens(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+
+	credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	var revoked, active User
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &revoked)
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &active); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+	if err := cfg.db.RevokeRefreshToken(context.Background(), revoked.RefreshToken); err != nil {
+		t.Fatalf("RevokeRefreshToken() error = %v", err)
+	}
+
+	// Purge as if the retention period had already passed.
+	if _, err := cfg.db.DeleteStaleRefreshTokens(context.Background(), time.Now().UTC().Add(time.Minute)); err != nil {
+		t.Fatalf("DeleteStaleRefreshTokens() error = %v", err)
+	}
+	tokens, err := cfg.db.ListRefreshTokensForUser(context.Background(), active.Id)
+	if err != nil {
+		t.Fatalf("ListRefreshTokensForUser() error = %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].RevokedAt.Valid {
+		t.Errorf("tokens = %+v, want only the active one", tokens)
+	}
+}
@@ -3,10 +3,23 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerMetrics() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix, length := auth.PasswordHashFormat()
+		hashes, err := cfg.db.CountPasswordHashes(r.Context(), database.CountPasswordHashesParams{
+			CurrentPrefix: prefix,
+			CurrentLength: int32(length),
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't count password hashes", err)
+			return
+		}
+
 		r.Header.Add("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w,
@@ -15,10 +28,13 @@ func (cfg *apiConfig) handlerMetrics() http.Handler {
 	<body>
 		<h1>Welcome, Chirpy Admin</h1>
 		<p>Chirpy has been visited %d times!</p>
+		<p>%d of %d users have passwords hashed with legacy parameters.</p>
 	</body>
 </html>
 			`,
-			cfg.fileserverHits.Load())
+			cfg.fileserverHits.Load(),
+			hashes.Legacy,
+			hashes.Total)
 	})
 }
 
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+)
+
+const (
+	mfaIssuer            = "Chirpy"
+	mfaChallengeLifetime = 5 * time.Minute
+	mfaRecoveryCodeCount = 10
+)
+
+func (cfg *apiConfig) mfaEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	userMFA, err := cfg.db.GetUserMFA(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return userMFA.EnabledAt.Valid, nil
+}
+
+// respondWithMFAChallenge answers a correct first factor with a short-lived
+// challenge token instead of real tokens.
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+	mfaToken, err := auth.MakeMFAToken(dbUser.ID, cfg.jwtSecret, mfaChallengeLifetime)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't generate MFA token", err)
+		return
+	}
+	type payload struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	respondWithJSON(w, http.StatusOK, payload{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+// Each TOTP time step and each recovery code can only be used once.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		rows, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+			UserID:   userID,
+		})
+		if err != nil {
+			return false, err
+		}
+		return rows == 1, nil
+	}
+
+	userMFA, err := cfg.db.GetUserMFA(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !userMFA.EnabledAt.Valid {
+		return false, nil
+	}
+	step, ok := auth.ValidateTOTP(userMFA.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	rows, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (cfg *apiConfig) handlerLoginMFA() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			MFAToken     string `json:"mfa_token"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+			UseCookies   bool   `json:"use_cookies"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		userID, err := auth.ValidateMFAToken(params.MFAToken, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid or expired MFA token", err)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserById(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusUnauthorized, "User not found", err)
+			return
+		}
+
+		// Second factor guesses count towards the same lockout as passwords,
+		// otherwise a stolen password would allow guessing codes freely.
+		ip := cfg.clientIP(r)
+		retryAfter, err := cfg.loginLockout(r.Context(), dbUser.Email, ip)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't check login lockout", err)
+			return
+		}
+		if retryAfter > 0 {
+			cfg.recordLoginAttempt(r, loginAttempt{
+				userID:        uuid.NullUUID{UUID: dbUser.ID, Valid: true},
+				email:         dbUser.Email,
+				method:        loginMethodMFA,
+				failureReason: loginFailureLockedOut,
+			})
+			respondWithLockout(w, r, retryAfter)
+			return
+		}
+
+		ok, err := cfg.verifySecondFactor(r.Context(), userID, params.Code, params.RecoveryCode)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't verify authentication code", err)
+			return
+		}
+		if !ok {
+			if err := cfg.recordLoginFailure(r.Context(), dbUser.Email, ip); err != nil {
+				logging.FromContext(r.Context()).Error("Couldn't record failed login", "error", err)
+			}
+			cfg.recordLoginAttempt(r, loginAttempt{
+				userID:        uuid.NullUUID{UUID: dbUser.ID, Valid: true},
+				email:         dbUser.Email,
+				method:        loginMethodMFA,
+				failureReason: loginFailureInvalidMFACode,
+			})
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid authentication code", nil)
+			return
+		}
+		cfg.clearAccountThrottle(r.Context(), dbUser.Email)
+
+		cfg.respondWithTokens(w, r, dbUser, loginMethodMFA, params.UseCookies)
+	})
+}
+
+func (cfg *apiConfig) handlerEnrollMFA() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserById(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusNotFound, "User not found", err)
+			return
+		}
+
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't generate TOTP secret", err)
+			return
+		}
+
+		// The upsert only replaces pending enrollments, so an enabled
+		// secret is never silently overwritten.
+		userMFA, err := cfg.db.UpsertPendingUserMFA(r.Context(), database.UpsertPendingUserMFAParams{
+			UserID: userID,
+			Secret: secret,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusConflict, "Two-factor authentication is already enabled", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't start two-factor enrollment", err)
+			return
+		}
+
+		type payload struct {
+			Secret     string `json:"secret"`
+			OTPAuthURI string `json:"otpauth_uri"`
+		}
+		respondWithJSON(w, http.StatusCreated, payload{
+			Secret:     userMFA.Secret,
+			OTPAuthURI: auth.TOTPURI(userMFA.Secret, mfaIssuer, dbUser.Email),
+		})
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmMFA() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		type parameters struct {
+			Code string `json:"code"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		userMFA, err := cfg.db.GetUserMFA(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Two-factor enrollment not started", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't fetch two-factor enrollment", err)
+			return
+		}
+		if userMFA.EnabledAt.Valid {
+			respondWithError(w, r, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+			return
+		}
+
+		step, ok := auth.ValidateTOTP(userMFA.Secret, params.Code, time.Now())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid authentication code", nil)
+			return
+		}
+		rows, err := cfg.db.EnableUserMFA(r.Context(), database.EnableUserMFAParams{
+			UserID:       userID,
+			LastUsedStep: step,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+			return
+		}
+		if rows != 1 {
+			respondWithError(w, r, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+			return
+		}
+
+		if err := cfg.db.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't reset recovery codes", err)
+			return
+		}
+		recoveryCodes := auth.MakeRecoveryCodes(mfaRecoveryCodeCount)
+		for _, code := range recoveryCodes {
+			if err := cfg.db.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+				CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+				UserID:   userID,
+			}); err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't store recovery codes", err)
+				return
+			}
+		}
+
+		type payload struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		respondWithJSON(w, http.StatusOK, payload{
+			RecoveryCodes: recoveryCodes,
+		})
+	})
+}
+
+func (cfg *apiConfig) handlerDisableMFA() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		type parameters struct {
+			Password     string `json:"password"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserById(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusNotFound, "User not found", err)
+			return
+		}
+		if !cfg.reauthenticate(w, r, dbUser, params.Password) {
+			return
+		}
+
+		ok, err = cfg.verifySecondFactor(r.Context(), userID, params.Code, params.RecoveryCode)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Two-factor authentication is not enabled", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't verify authentication code", err)
+			return
+		}
+		if !ok {
+			if err := cfg.recordLoginFailure(r.Context(), dbUser.Email, cfg.clientIP(r)); err != nil {
+				logging.FromContext(r.Context()).Error("Couldn't record failed login", "error", err)
+			}
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid authentication code", nil)
+			return
+		}
+		cfg.clearAccountThrottle(r.Context(), dbUser.Email)
+
+		if err := cfg.db.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't delete recovery codes", err)
+			return
+		}
+		if err := cfg.db.DeleteUserMFA(r.Context(), userID); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+)
+
+const (
+	oauthClientIDPrefix         = "chirpy_client_"
+	oauthCodeLifetime           = 5 * time.Minute
+	oauthAccessTokenLifetime    = time.Hour
+	oauthRefreshTokenLifetime   = 60 * 24 * time.Hour
+	oauthMaxRedirectURIs        = 10
+	oauthCodeChallengeMethod    = "S256"
+	oauthGrantAuthorizationCode = "authorization_code"
+	oauthGrantRefreshToken      = "refresh_token"
+)
+
+// oauthScopes are the scopes third-party clients may ask users for. Admin
+// access is never delegated to them.
+var oauthScopes = []string{
+	auth.ScopeChirpsRead,
+	auth.ScopeChirpsWrite,
+	auth.ScopeProfileRead,
+	auth.ScopeProfileWrite,
+	auth.ScopeWebhooks,
+}
+
+var oauthScopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:   "Read chirps",
+	auth.ScopeChirpsWrite:  "Post and delete chirps as you",
+	auth.ScopeProfileRead:  "See your email address",
+	auth.ScopeProfileWrite: "Change your email address and password",
+	auth.ScopeWebhooks:     "Get notified when you chirp",
+}
+
+var defaultOAuthScopes = []string{auth.ScopeChirpsRead}
+
+// parseOAuthScopes parses a space separated scope parameter, falling back to
+// the default scopes when it is empty.
+func parseOAuthScopes(scope string) ([]string, bool) {
+	fields := strings.Fields(scope)
+	if len(fields) == 0 {
+		return defaultOAuthScopes, true
+	}
+	scopes := []string{}
+	for _, field := range fields {
+		if !slices.Contains(oauthScopes, field) {
+			return nil, false
+		}
+		if !slices.Contains(scopes, field) {
+			scopes = append(scopes, field)
+		}
+	}
+	return scopes, true
+}
+
+// validRedirectURI only accepts absolute https URIs, or plain http ones for
+// clients running on the user's own machine.
+func validRedirectURI(rawURI string) bool {
+	uri, err := url.Parse(rawURI)
+	if err != nil || uri.Host == "" || uri.Fragment != "" || uri.User != nil {
+		return false
+	}
+	switch uri.Scheme {
+	case "https":
+		return true
+	case "http":
+		if uri.Hostname() == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(uri.Hostname())
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
+
+type OAuthClient struct {
+	ClientID     string    `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	// ClientSecret is only included in the response that creates it.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (cfg *apiConfig) handlerCreateOAuthClient() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		type parameters struct {
+			Name         string   `json:"name"`
+			RedirectURIs []string `json:"redirect_uris"`
+			Confidential bool     `json:"confidential"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		if params.Name == "" {
+			respondWithError(w, r, http.StatusBadRequest, "Client name is required", nil)
+			return
+		}
+		if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > oauthMaxRedirectURIs {
+			respondWithError(w, r, http.StatusBadRequest, "Between 1 and 10 redirect URIs are required", nil)
+			return
+		}
+		for _, redirectURI := range params.RedirectURIs {
+			if !validRedirectURI(redirectURI) {
+				respondWithError(w, r, http.StatusBadRequest, "Invalid redirect URI: "+redirectURI, nil)
+				return
+			}
+		}
+
+		// Public clients, such as mobile and single-page apps, can't keep a
+		// secret and rely on PKCE alone.
+		var secret string
+		var secretHash sql.NullString
+		if params.Confidential {
+			secret = auth.MakeRefreshToken()
+			secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+		}
+
+		dbClient, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+			ID:           oauthClientIDPrefix + auth.MakeRefreshToken()[:32],
+			UserID:       userID,
+			Name:         params.Name,
+			SecretHash:   secretHash,
+			RedirectUris: params.RedirectURIs,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create OAuth client", err)
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, OAuthClient{
+			ClientID:     dbClient.ID,
+			CreatedAt:    dbClient.CreatedAt,
+			Name:         dbClient.Name,
+			RedirectURIs: dbClient.RedirectUris,
+			Confidential: dbClient.SecretHash.Valid,
+			ClientSecret: secret,
+		})
+	})
+}
+
+// authorizeRequest is an authorization request whose client and redirect URI
+// have been checked, so errors can safely be sent back to the client.
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	State         string
+	Scope         string
+	Scopes        []string
+	CodeChallenge string
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization request.
+// Problems with the client or redirect URI are reported to the user, since
+// the redirect URI can't be trusted; everything else is reported to the
+// client through redirectErr.
+func (cfg *apiConfig) parseAuthorizeRequest(r *http.Request) (req authorizeRequest, userErr string, redirectErr string) {
+	client, err := cfg.db.GetOAuthClient(r.Context(), r.Form.Get("client_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, "Unknown application.", ""
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Couldn't get OAuth client", "error", err)
+		return req, "Something went wrong, try again later.", ""
+	}
+	redirectURI := r.Form.Get("redirect_uri")
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return req, "The application sent you here with an unregistered redirect URI.", ""
+	}
+
+	req = authorizeRequest{
+		Client:        client,
+		RedirectURI:   redirectURI,
+		State:         r.Form.Get("state"),
+		Scope:         r.Form.Get("scope"),
+		CodeChallenge: r.Form.Get("code_challenge"),
+	}
+	if r.Form.Get("response_type") != "code" {
+		return req, "", "unsupported_response_type"
+	}
+	if req.CodeChallenge == "" || r.Form.Get("code_challenge_method") != oauthCodeChallengeMethod {
+		return req, "", "invalid_request"
+	}
+	scopes, ok := parseOAuthScopes(req.Scope)
+	if !ok {
+		return req, "", "invalid_scope"
+	}
+	req.Scopes = scopes
+	return req, "", ""
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	uri, err := url.Parse(redirectURI)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't parse redirect URI", err)
+		return
+	}
+	query := uri.Query()
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+	uri.RawQuery = query.Encode()
+	http.Redirect(w, r, uri.String(), http.StatusFound)
+}
+
+func redirectWithOAuthError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code string) {
+	redirectWithParams(w, r, req.RedirectURI, url.Values{
+		"error": {code},
+		"state": {req.State},
+	})
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Authorize {{.ClientName}} - Chirpy</title>
+</head>
+<body>
+  {{if .UserError}}
+  <h1>Can't authorize this application</h1>
+  <p>{{.UserError}}</p>
+  {{else}}
+  <h1>{{.ClientName}} wants to access your Chirpy account</h1>
+  <p>It will be able to:</p>
+  <ul>
+    {{range .Scopes}}<li>{{.}}</li>
+    {{end}}
+  </ul>
+  {{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+  <form method="post" action="/oauth/authorize">
+    <input type="hidden" name="response_type" value="code">
+    <input type="hidden" name="client_id" value="{{.ClientID}}">
+    <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+    <input type="hidden" name="scope" value="{{.Scope}}">
+    <input type="hidden" name="state" value="{{.State}}">
+    <input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+    <input type="hidden" name="code_challenge_method" value="S256">
+    <label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username"></label>
+    <label>Password <input type="password" name="password" autocomplete="current-password"></label>
+    <label>Two-factor code, if enabled <input type="text" name="mfa_code" inputmode="numeric" autocomplete="one-time-code"></label>
+    <button type="submit" name="decision" value="allow">Allow</button>
+    <button type="submit" name="decision" value="deny">Deny</button>
+  </form>
+  {{end}}
+</body>
+</html>
+`))
+
+type consentPage struct {
+	UserError     string
+	Error         string
+	ClientName    string
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+	Email         string
+}
+
+func renderConsentPage(w http.ResponseWriter, r *http.Request, code int, page consentPage) {
+	// The consent page collects credentials, so it must never be framed by
+	// the application asking for access.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := consentTemplate.Execute(w, page); err != nil {
+		logging.FromContext(r.Context()).Error("Couldn't render consent page", "error", err)
+	}
+}
+
+func newConsentPage(req authorizeRequest) consentPage {
+	page := consentPage{
+		ClientName:    req.Client.Name,
+		ClientID:      req.Client.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(req.Scopes, " "),
+		State:         req.State,
+		CodeChallenge: req.CodeChallenge,
+	}
+	for _, scope := range req.Scopes {
+		page.Scopes = append(page.Scopes, oauthScopeDescriptions[scope])
+	}
+	return page
+}
+
+func (cfg *apiConfig) handlerAuthorizePage() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			renderConsentPage(w, r, http.StatusBadRequest, consentPage{UserError: "Invalid request."})
+			return
+		}
+		req, userErr, redirectErr := cfg.parseAuthorizeRequest(r)
+		if userErr != "" {
+			renderConsentPage(w, r, http.StatusBadRequest, consentPage{UserError: userErr})
+			return
+		}
+		if redirectErr != "" {
+			redirectWithOAuthError(w, r, req, redirectErr)
+			return
+		}
+		renderConsentPage(w, r, http.StatusOK, newConsentPage(req))
+	})
+}
+
+func (cfg *apiConfig) handlerAuthorize() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			renderConsentPage(w, r, http.StatusBadRequest, consentPage{UserError: "Invalid request."})
+			return
+		}
+		req, userErr, redirectErr := cfg.parseAuthorizeRequest(r)
+		if userErr != "" {
+			renderConsentPage(w, r, http.StatusBadRequest, consentPage{UserError: userErr})
+			return
+		}
+		if redirectErr != "" {
+			redirectWithOAuthError(w, r, req, redirectErr)
+			return
+		}
+		if r.PostForm.Get("decision") != "allow" {
+			redirectWithOAuthError(w, r, req, "access_denied")
+			return
+		}
+
+		email := r.PostForm.Get("email")
+		page := newConsentPage(req)
+		page.Email = email
+
+		ip := cfg.clientIP(r)
+		retryAfter, err := cfg.loginLockout(r.Context(), email, ip)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Couldn't check login lockout", "error", err)
+			page.Error = "Something went wrong, try again later."
+			renderConsentPage(w, r, http.StatusInternalServerError, page)
+			return
+		}
+		if retryAfter > 0 {
+			cfg.recordLoginFailureForEmail(r, email, loginMethodOAuth, loginFailureLockedOut)
+			page.Error = "Too many failed login attempts, try again later."
+			renderConsentPage(w, r, http.StatusTooManyRequests, page)
+			return
+		}
+
+		dbUser, err := cfg.db.GetUserByEmail(r.Context(), email)
+		if err == nil {
+			var match bool
+			match, err = auth.CheckPasswordHash(r.PostForm.Get("password"), dbUser.HashedPassword)
+			if err == nil && !match {
+				err = errors.New("incorrect password")
+			}
+		}
+		if err == nil {
+			var mfaEnabled, verified bool
+			mfaEnabled, err = cfg.mfaEnabled(r.Context(), dbUser.ID)
+			if err == nil && mfaEnabled {
+				verified, err = cfg.verifySecondFactor(r.Context(), dbUser.ID, r.PostForm.Get("mfa_code"), "")
+				if err == nil && !verified {
+					err = errors.New("invalid two-factor code")
+				}
+			}
+		}
+		if err != nil {
+			if err := cfg.recordLoginFailure(r.Context(), email, ip); err != nil {
+				logging.FromContext(r.Context()).Error("Couldn't record failed login", "error", err)
+			}
+			cfg.recordLoginFailureForEmail(r, email, loginMethodOAuth, loginFailureInvalidCredentials)
+			page.Error = "Incorrect email, password or two-factor code."
+			renderConsentPage(w, r, http.StatusUnauthorized, page)
+			return
+		}
+		cfg.clearAccountThrottle(r.Context(), dbUser.Email)
+		cfg.recordLoginAttempt(r, loginAttempt{
+			userID:        uuid.NullUUID{UUID: dbUser.ID, Valid: true},
+			email:         dbUser.Email,
+			method:        loginMethodOAuth,
+			oauthClientID: req.Client.ID,
+		})
+		if err := cfg.restoreAccount(r.Context(), dbUser); err != nil {
+			logging.FromContext(r.Context()).Error("Couldn't restore account", "error", err)
+			redirectWithOAuthError(w, r, req, "server_error")
+			return
+		}
+
+		code := auth.MakeRefreshToken()
+		if err := cfg.db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+			CodeHash:      auth.HashToken(code),
+			ClientID:      req.Client.ID,
+			UserID:        dbUser.ID,
+			RedirectUri:   req.RedirectURI,
+			Scopes:        req.Scopes,
+			CodeChallenge: req.CodeChallenge,
+			ExpiresAt:     time.Now().UTC().Add(oauthCodeLifetime),
+		}); err != nil {
+			logging.FromContext(r.Context()).Error("Couldn't create authorization code", "error", err)
+			redirectWithOAuthError(w, r, req, "server_error")
+			return
+		}
+		redirectWithParams(w, r, req.RedirectURI, url.Values{
+			"code":  {code},
+			"state": {req.State},
+		})
+	})
+}
+
+// respondWithOAuthError uses the error response format from RFC 6749
+// section 5.2, which OAuth client libraries expect.
+func respondWithOAuthError(w http.ResponseWriter, r *http.Request, code int, errorCode, description string, err error) {
+	logger := logging.FromContext(r.Context())
+	if code > 499 {
+		logger.Error("Responding with 5XX error", "status", code, "error_code", errorCode, "error", err)
+	} else if err != nil {
+		logger.Info("Responding with error", "status", code, "error_code", errorCode, "error", err)
+	}
+	type errorResponse struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, errorResponse{
+		Error:            errorCode,
+		ErrorDescription: description,
+	})
+}
+
+// authenticateOAuthClient identifies the client calling the token or
+// revocation endpoint, from HTTP Basic credentials or from the request body.
+// Confidential clients must present their secret.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, usedBasic := r.BasicAuth()
+	if usedBasic {
+		// RFC 6749 section 2.3.1 has clients form-encode these first.
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return database.OauthClient{}, err
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return database.OauthClient{}, err
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, errors.New("invalid client secret")
+		}
+	} else if secret != "" {
+		return database.OauthClient{}, errors.New("public client sent a secret")
+	}
+	return client, nil
+}
+
+func (cfg *apiConfig) handlerOAuthToken() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_request", "Couldn't parse form", err)
+			return
+		}
+		client, err := cfg.authenticateOAuthClient(r)
+		if err != nil {
+			if _, _, usedBasic := r.BasicAuth(); usedBasic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+			}
+			respondWithOAuthError(w, r, http.StatusUnauthorized, "invalid_client", "Client authentication failed", err)
+			return
+		}
+
+		switch r.PostForm.Get("grant_type") {
+		case oauthGrantAuthorizationCode:
+			cfg.exchangeAuthorizationCode(w, r, client)
+		case oauthGrantRefreshToken:
+			cfg.exchangeOAuthRefreshToken(w, r, client)
+		default:
+			respondWithOAuthError(w, r, http.StatusBadRequest, "unsupported_grant_type", "", nil)
+		}
+	})
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	// Codes are consumed even when the rest of the request turns out to be
+	// invalid, so a leaked code can't be retried.
+	code, err := cfg.db.UseOAuthAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or already used", nil)
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, r, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_grant", "Authorization code was issued to another client or redirect URI", nil)
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_grant", "Code verifier doesn't match the code challenge", nil)
+		return
+	}
+	cfg.respondWithOAuthTokens(w, r, client, code.UserID, code.Scopes)
+}
+
+func (cfg *apiConfig) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	clientID := sql.NullString{String: client.ID, Valid: true}
+	refreshToken, err := cfg.db.GetOAuthRefreshToken(r.Context(), database.GetOAuthRefreshTokenParams{
+		Token:    r.PostForm.Get("refresh_token"),
+		ClientID: clientID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid, expired or revoked", nil)
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, r, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	// Clients may ask for fewer scopes than the user granted, never more.
+	scopes := refreshToken.Scopes
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		var ok bool
+		scopes, ok = parseOAuthScopes(requested)
+		if !ok || slices.ContainsFunc(scopes, func(scope string) bool {
+			return !slices.Contains(refreshToken.Scopes, scope)
+		}) {
+			respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_scope", "Requested scopes exceed the original grant", nil)
+			return
+		}
+	}
+
+	// Refresh tokens are rotated on every use. Checking the revocation
+	// actually happened stops two concurrent requests from both using one.
+	rows, err := cfg.db.RevokeOAuthRefreshToken(r.Context(), database.RevokeOAuthRefreshTokenParams{
+		Token:    refreshToken.Token,
+		ClientID: clientID,
+	})
+	if err != nil {
+		respondWithOAuthError(w, r, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	if rows == 0 {
+		respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid, expired or revoked", nil)
+		return
+	}
+	cfg.respondWithOAuthTokens(w, r, client, refreshToken.UserID, scopes)
+}
+
+func (cfg *apiConfig) respondWithOAuthTokens(w http.ResponseWriter, r *http.Request, client database.OauthClient, userID uuid.UUID, scopes []string) {
+	accessToken, err := auth.MakeScopedJWT(userID, cfg.jwtSecret, oauthAccessTokenLifetime, client.ID, scopes)
+	if err != nil {
+		respondWithOAuthError(w, r, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	refreshToken, err := cfg.db.CreateOAuthRefreshToken(r.Context(), database.CreateOAuthRefreshTokenParams{
+		Token:     auth.MakeRefreshToken(),
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(oauthRefreshTokenLifetime),
+		ClientID:  sql.NullString{String: client.ID, Valid: true},
+		Scopes:    scopes,
+	})
+	if err != nil {
+		respondWithOAuthError(w, r, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	type payload struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, payload{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenLifetime.Seconds()),
+		RefreshToken: refreshToken.Token,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// handlerOAuthRevoke implements RFC 7009. It succeeds for unknown tokens too,
+// so clients can't probe which tokens exist. Access tokens are short-lived
+// JWTs and simply expire.
+func (cfg *apiConfig) handlerOAuthRevoke() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWithOAuthError(w, r, http.StatusBadRequest, "invalid_request", "Couldn't parse form", err)
+			return
+		}
+		client, err := cfg.authenticateOAuthClient(r)
+		if err != nil {
+			if _, _, usedBasic := r.BasicAuth(); usedBasic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+			}
+			respondWithOAuthError(w, r, http.StatusUnauthorized, "invalid_client", "Client authentication failed", err)
+			return
+		}
+		if _, err := cfg.db.RevokeOAuthRefreshToken(r.Context(), database.RevokeOAuthRefreshTokenParams{
+			Token:    r.PostForm.Get("token"),
+			ClientID: sql.NullString{String: client.ID, Valid: true},
+		}); err != nil {
+			respondWithOAuthError(w, r, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
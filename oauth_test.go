@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+)
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	Error        string `json:"error"`
+}
+
+// fakeOAuthClient is a confidential third-party app, which completes the
+// authorization code flow in its redirect handler like a real one would.
+type fakeOAuthClient struct {
+	t        *testing.T
+	chirpy   string
+	server   *httptest.Server
+	id       string
+	secret   string
+	state    string
+	verifier string
+	tokens   chan oauthTokenResponse
+}
+
+func newFakeOAuthClient(t *testing.T, chirpy string) *fakeOAuthClient {
+	client := &fakeOAuthClient{
+		t:        t,
+		chirpy:   chirpy,
+		state:    uuid.NewString(),
+		verifier: auth.MakePKCEVerifier(),
+		tokens:   make(chan oauthTokenResponse, 1),
+	}
+	client.server = httptest.NewServer(http.HandlerFunc(client.handleCallback))
+	t.Cleanup(client.server.Close)
+	return client
+}
+
+func (c *fakeOAuthClient) redirectURI() string {
+	return c.server.URL + "/callback"
+}
+
+func (c *fakeOAuthClient) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("state") != c.state {
+		c.t.Errorf("callback state = %q, want %q", r.URL.Query().Get("state"), c.state)
+	}
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		c.tokens <- oauthTokenResponse{Error: errCode}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	c.tokens <- c.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {r.URL.Query().Get("code")},
+		"redirect_uri":  {c.redirectURI()},
+		"code_verifier": {c.verifier},
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *fakeOAuthClient) post(path string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, c.chirpy+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.id, c.secret)
+	return http.DefaultClient.Do(req)
+}
+
+// token may be called from the callback handler, so it reports failures
+// without stopping the test.
+func (c *fakeOAuthClient) token(form url.Values) oauthTokenResponse {
+	resp, err := c.post("/oauth/token", form)
+	if err != nil {
+		c.t.Errorf("POST /oauth/token: %v", err)
+		return oauthTokenResponse{}
+	}
+	defer resp.Body.Close()
+	var tokens oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		c.t.Errorf("Couldn't decode token response: %v", err)
+	}
+	return tokens
+}
+
+func (c *fakeOAuthClient) authorizeURL(scope string) string {
+	return c.chirpy + "/oauth/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.id},
+		"redirect_uri":          {c.redirectURI()},
+		"scope":                 {scope},
+		"state":                 {c.state},
+		"code_challenge":        {auth.PKCEChallenge(c.verifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	chirpy, _ := newTestServer(t)
+
+	email := uuid.NewString() + "@example.com"
+	password := "correct horse battery staple"
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, nil); code != http.StatusCreated {
+		t.Fatalf("register status = %d, want %d", code, http.StatusCreated)
+	}
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+
+	client := newFakeOAuthClient(t, chirpy.URL)
+	var registered OAuthClient
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/oauth/clients", user.Token, map[string]any{
+		"name":          "Fake client",
+		"redirect_uris": []string{client.redirectURI()},
+		"confidential":  true,
+	}, &registered); code != http.StatusCreated {
+		t.Fatalf("register client status = %d, want %d", code, http.StatusCreated)
+	}
+	client.id = registered.ClientID
+	client.secret = registered.ClientSecret
+
+	authorizeURL := client.authorizeURL(auth.ScopeChirpsRead + " " + auth.ScopeChirpsWrite)
+	resp, err := http.Get(authorizeURL)
+	if err != nil {
+		t.Fatalf("GET /oauth/authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("consent page status = %d, X-Frame-Options = %q", resp.StatusCode, resp.Header.Get("X-Frame-Options"))
+	}
+
+	// Submitting the consent form redirects the browser to the fake client,
+	// which exchanges the code for tokens.
+	consent, _ := url.Parse(authorizeURL)
+	form := consent.Query()
+	form.Set("email", email)
+	form.Set("password", password)
+	form.Set("decision", "allow")
+	resp, err = http.PostForm(chirpy.URL+"/oauth/authorize", form)
+	if err != nil {
+		t.Fatalf("POST /oauth/authorize: %v", err)
+	}
+	resp.Body.Close()
+	tokens := <-client.tokens
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("token exchange = %+v, want tokens", tokens)
+	}
+	if tokens.Scope != "chirps:read chirps:write" {
+		t.Errorf("token scope = %q, want %q", tokens.Scope, "chirps:read chirps:write")
+	}
+
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", tokens.AccessToken, map[string]string{
+		"body": "Posted through OAuth",
+	}, nil); code != http.StatusCreated {
+		t.Errorf("create chirp status = %d, want %d", code, http.StatusCreated)
+	}
+	if code := doJSON(t, http.MethodPut, chirpy.URL+"/api/users", tokens.AccessToken, map[string]string{
+		"email":    email,
+		"password": password,
+	}, nil); code != http.StatusForbidden {
+		t.Errorf("update user status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/oauth/clients", tokens.AccessToken, map[string]any{
+		"name":          "Sneaky client",
+		"redirect_uris": []string{client.redirectURI()},
+	}, nil); code != http.StatusForbidden {
+		t.Errorf("register client with OAuth token status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// OAuth refresh tokens only work at the OAuth token endpoint.
+	req, _ := http.NewRequest(http.MethodPost, chirpy.URL+"/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.RefreshToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /api/refresh: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("first-party refresh status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	refreshed := client.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+		"scope":         {auth.ScopeChirpsRead},
+	})
+	if refreshed.AccessToken == "" || refreshed.Scope != auth.ScopeChirpsRead {
+		t.Fatalf("refresh = %+v, want narrowed tokens", refreshed)
+	}
+	if code := doJSON(t, http.MethodGet, chirpy.URL+"/api/chirps", refreshed.AccessToken, nil, nil); code != http.StatusOK {
+		t.Errorf("list chirps with chirps:read status = %d, want %d", code, http.StatusOK)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", refreshed.AccessToken, map[string]string{
+		"body": "Posted without chirps:write",
+	}, nil); code != http.StatusForbidden {
+		t.Errorf("create chirp without chirps:write status = %d, want %d", code, http.StatusForbidden)
+	}
+	if reused := client.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	}); reused.Error != "invalid_grant" {
+		t.Errorf("reusing rotated refresh token error = %q, want invalid_grant", reused.Error)
+	}
+
+	resp, err = client.post("/oauth/revoke", url.Values{"token": {refreshed.RefreshToken}})
+	if err != nil {
+		t.Fatalf("POST /oauth/revoke: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("revoke status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if revoked := client.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshed.RefreshToken},
+	}); revoked.Error != "invalid_grant" {
+		t.Errorf("revoked refresh token error = %q, want invalid_grant", revoked.Error)
+	}
+}
+
+func TestOAuthAuthorizeDenied(t *testing.T) {
+	chirpy, _ := newTestServer(t)
+
+	email := uuid.NewString() + "@example.com"
+	password := "correct horse battery staple"
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, nil)
+	var user User
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, &user)
+
+	client := newFakeOAuthClient(t, chirpy.URL)
+	var registered OAuthClient
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/oauth/clients", user.Token, map[string]any{
+		"name":          "Fake public client",
+		"redirect_uris": []string{client.redirectURI()},
+	}, &registered); code != http.StatusCreated {
+		t.Fatalf("register client status = %d, want %d", code, http.StatusCreated)
+	}
+	client.id = registered.ClientID
+
+	consent, _ := url.Parse(client.authorizeURL(""))
+	form := consent.Query()
+	form.Set("decision", "deny")
+	resp, err := http.PostForm(chirpy.URL+"/oauth/authorize", form)
+	if err != nil {
+		t.Fatalf("POST /oauth/authorize: %v", err)
+	}
+	resp.Body.Close()
+	if tokens := <-client.tokens; tokens.Error != "access_denied" {
+		t.Errorf("callback error = %q, want access_denied", tokens.Error)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/oidc"
+	"github.com/gyulaieric/chirpy/internal/validation"
+)
+
+const (
+	oidcCookieName     = "chirpy_oidc"
+	oidcCookiePath     = "/api/login/oidc"
+	oidcLoginLifetime  = 10 * time.Minute
+	oidcCallbackSuffix = "/api/login/oidc/callback"
+)
+
+// oidcProviderFromEnv returns nil when OIDC login isn't configured.
+func oidcProviderFromEnv(ctx context.Context, baseURL string) (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID must be set when OIDC_ISSUER is")
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = baseURL + oidcCallbackSuffix
+	}
+	return oidc.Discover(ctx, issuer, clientID, os.Getenv("OIDC_CLIENT_SECRET"), redirectURL)
+}
+
+// handlerOIDCLogin sends the browser to the identity provider. The state,
+// nonce and PKCE verifier for this login are kept in a cookie, which ties the
+// callback to the browser that started it.
+func (cfg *apiConfig) handlerOIDCLogin() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.oidc == nil {
+			respondWithError(w, r, http.StatusNotFound, "Single sign-on isn't configured", nil)
+			return
+		}
+
+		state := auth.MakeRefreshToken()
+		nonce := auth.MakeRefreshToken()
+		verifier := auth.MakePKCEVerifier()
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcCookieName,
+			Value:    strings.Join([]string{state, nonce, verifier}, "."),
+			Path:     oidcCookiePath,
+			MaxAge:   int(oidcLoginLifetime.Seconds()),
+			HttpOnly: true,
+			Secure:   cfg.secureCookies(),
+			// Lax, so the cookie is sent when the provider redirects back.
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, cfg.oidc.AuthCodeURL(state, nonce, auth.PKCEChallenge(verifier)), http.StatusFound)
+	})
+}
+
+func (cfg *apiConfig) handlerOIDCCallback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.oidc == nil {
+			respondWithError(w, r, http.StatusNotFound, "Single sign-on isn't configured", nil)
+			return
+		}
+
+		cookie, err := r.Cookie(oidcCookieName)
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcCookieName,
+			Path:     oidcCookiePath,
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Login session expired, please sign in again", err)
+			return
+		}
+		parts := strings.Split(cookie.Value, ".")
+		if len(parts) != 3 {
+			respondWithError(w, r, http.StatusBadRequest, "Login session expired, please sign in again", nil)
+			return
+		}
+		state, nonce, verifier := parts[0], parts[1], parts[2]
+
+		query := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid login state", nil)
+			return
+		}
+		if providerErr := query.Get("error"); providerErr != "" {
+			respondWithError(w, r, http.StatusUnauthorized, "Identity provider didn't sign you in: "+providerErr, nil)
+			return
+		}
+
+		rawIDToken, err := cfg.oidc.Exchange(r.Context(), query.Get("code"), verifier)
+		if err != nil {
+			respondWithError(w, r, http.StatusUnauthorized, "Couldn't sign in with identity provider", err)
+			return
+		}
+		claims, err := cfg.oidc.VerifyIDToken(r.Context(), rawIDToken, nonce)
+		if err != nil {
+			respondWithError(w, r, http.StatusUnauthorized, "Couldn't sign in with identity provider", err)
+			return
+		}
+
+		dbUser, ok := cfg.userForOIDCIdentity(w, r, claims)
+		if !ok {
+			return
+		}
+
+		mfaEnabled, err := cfg.mfaEnabled(r.Context(), dbUser.ID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't check two-factor authentication", err)
+			return
+		}
+		// The callback is a browser navigation, so the user is sent on to the
+		// web app signed in with a cookie session rather than shown tokens.
+		if mfaEnabled {
+			// The web app finishes signing in by sending the token and a code
+			// to /api/login/mfa. Browsers don't send the fragment to servers.
+			mfaToken, err := auth.MakeMFAToken(dbUser.ID, cfg.jwtSecret, mfaChallengeLifetime)
+			if err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, "Couldn't generate MFA token", err)
+				return
+			}
+			http.Redirect(w, r, webAppPath+"#mfa_token="+mfaToken, http.StatusSeeOther)
+			return
+		}
+		if _, ok := cfg.issueTokens(w, r, dbUser, loginMethodOIDC, true); !ok {
+			return
+		}
+		http.Redirect(w, r, webAppPath, http.StatusSeeOther)
+	})
+}
+
+// userForOIDCIdentity finds the user an identity belongs to. Identities seen
+// for the first time are linked to the user with the same email address, or
+// a new user is created for them, as long as the provider has verified the
+// address. It responds with an error and returns false if there's no user.
+func (cfg *apiConfig) userForOIDCIdentity(w http.ResponseWriter, r *http.Request, claims oidc.Claims) (database.User, bool) {
+	identity, err := cfg.db.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Issuer:  cfg.oidc.Issuer,
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		if err := cfg.db.TouchUserIdentity(r.Context(), database.TouchUserIdentityParams{
+			ID:    identity.ID,
+			Email: claims.Email,
+		}); err != nil {
+			logging.FromContext(r.Context()).Error("Couldn't update identity", "identity_id", identity.ID, "error", err)
+		}
+		dbUser, err := cfg.db.GetUserById(r.Context(), identity.UserID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+			return database.User{}, false
+		}
+		return dbUser, true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't get identity", err)
+		return database.User{}, false
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		respondWithError(w, r, http.StatusForbidden, "Your identity provider hasn't verified your email address", nil)
+		return database.User{}, false
+	}
+	email, err := validation.NormalizeEmail(claims.Email)
+	if err != nil {
+		respondWithError(w, r, http.StatusForbidden, "Your identity provider sent an invalid email address", err)
+		return database.User{}, false
+	}
+
+	dbUser, err := cfg.db.GetUserByEmail(r.Context(), email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		dbUser, err = cfg.createOIDCUser(r.Context(), email)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create user", err)
+			return database.User{}, false
+		}
+	case err != nil:
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+		return database.User{}, false
+	case !dbUser.EmailVerifiedAt.Valid:
+		// Anyone can sign up with an address they don't own, so only link
+		// to accounts that have proven they own theirs.
+		respondWithError(w, r, http.StatusConflict, "An account with this email address exists, but the address isn't verified. Verify it, then sign in again", nil)
+		return database.User{}, false
+	}
+
+	if _, err := cfg.db.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		UserID:  dbUser.ID,
+		Issuer:  cfg.oidc.Issuer,
+		Subject: claims.Subject,
+		Email:   email,
+	}); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't link identity", err)
+		return database.User{}, false
+	}
+	return dbUser, true
+}
+
+// createOIDCUser creates a user who signs in through the identity provider.
+// They get a random password nobody knows, which they can replace through a
+// password reset if they want to log in with Chirpy directly.
+func (cfg *apiConfig) createOIDCUser(ctx context.Context, email string) (database.User, error) {
+	hashedPassword, err := auth.HashPassword(auth.MakeRefreshToken())
+	if err != nil {
+		return database.User{}, err
+	}
+	dbUser, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if _, err := cfg.db.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{
+		ID:    dbUser.ID,
+		Email: dbUser.Email,
+	}); err != nil {
+		return database.User{}, err
+	}
+	return cfg.db.GetUserById(ctx, dbUser.ID)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/oidc"
+	"github.com/gyulaieric/chirpy/internal/oidc/oidctest"
+)
+
+// signInWithOIDC goes through the single sign-on flow in a fresh browser
+// session. It returns the status of the callback and, if the callback
+// started a cookie session, the user signed in.
+func signInWithOIDC(t *testing.T, chirpyURL string) (int, User) {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if strings.HasPrefix(req.URL.Path, webAppPath) {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	resp, err := browser.Get(chirpyURL + "/api/login/oidc")
+	if err != nil {
+		t.Fatalf("GET /api/login/oidc: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		return resp.StatusCode, User{}
+	}
+	if location := resp.Header.Get("Location"); location != webAppPath {
+		t.Errorf("callback redirected to %q, want %q", location, webAppPath)
+	}
+
+	resp, err = browser.Get(chirpyURL + "/api/users/me")
+	if err != nil {
+		t.Fatalf("GET /api/users/me: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/users/me with session cookies status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var user User
+	json.NewDecoder(resp.Body).Decode(&user)
+	return http.StatusSeeOther, user
+}
+
+func TestOIDCLogin(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	mock := oidctest.NewProvider("chirpy", "secret")
+	defer mock.Close()
+	provider, err := oidc.Discover(context.Background(), mock.URL, "chirpy", "secret", chirpy.URL+"/api/login/oidc/callback")
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	cfg.oidc = provider
+
+	// The first sign in creates a user, and later ones find it again.
+	employee := oidctest.Identity{
+		Subject:       uuid.NewString(),
+		Email:         uuid.NewString() + "@example.com",
+		EmailVerified: true,
+	}
+	mock.SetIdentity(employee)
+	code, created := signInWithOIDC(t, chirpy.URL)
+	if code != http.StatusSeeOther || !created.EmailVerified {
+		t.Fatalf("first sign in = %d %+v, want a verified user signed in", code, created)
+	}
+	employee.Email = uuid.NewString() + "@example.com"
+	mock.SetIdentity(employee)
+	if code, again := signInWithOIDC(t, chirpy.URL); code != http.StatusSeeOther || again.Id != created.Id {
+		t.Errorf("second sign in = %d %v, want user %v", code, again.Id, created.Id)
+	}
+
+	// Existing users are linked by verified email, but only once they have
+	// verified it with Chirpy too.
+	password := "correct horse battery staple"
+	existing := oidctest.Identity{
+		Subject:       uuid.NewString(),
+		Email:         uuid.NewString() + "@example.com",
+		EmailVerified: true,
+	}
+	var registered User
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", map[string]string{
+		"email":    existing.Email,
+		"password": password,
+	}, &registered)
+	mock.SetIdentity(existing)
+	if code, _ := signInWithOIDC(t, chirpy.URL); code != http.StatusConflict {
+		t.Errorf("sign in as unverified existing user status = %d, want %d", code, http.StatusConflict)
+	}
+	if _, err := cfg.db.MarkEmailVerified(context.Background(), database.MarkEmailVerifiedParams{
+		ID:    registered.Id,
+		Email: registered.Email,
+	}); err != nil {
+		t.Fatalf("MarkEmailVerified() error = %v", err)
+	}
+	if code, linked := signInWithOIDC(t, chirpy.URL); code != http.StatusSeeOther || linked.Id != registered.Id {
+		t.Errorf("sign in as existing user = %d %v, want user %v", code, linked.Id, registered.Id)
+	}
+
+	// Without an address the provider vouches for, there's nothing to link.
+	mock.SetIdentity(oidctest.Identity{
+		Subject: uuid.NewString(),
+		Email:   uuid.NewString() + "@example.com",
+	})
+	if code, _ := signInWithOIDC(t, chirpy.URL); code != http.StatusForbidden {
+		t.Errorf("sign in with unverified email status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// A callback the browser didn't start is rejected.
+	resp, err := http.Get(chirpy.URL + "/api/login/oidc/callback?code=stolen&state=guessed")
+	if err != nil {
+		t.Fatalf("GET /api/login/oidc/callback: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback without login session status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
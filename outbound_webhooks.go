@@ -0,0 +1,638 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+const (
+	webhookDeliveryPending   = "pending"
+	webhookDeliveryDelivered = "delivered"
+	webhookDeliveryFailed    = "failed"
+
+	webhookDispatchInterval = 5 * time.Second
+	webhookDeliveryTimeout  = 10 * time.Second
+	// webhookDeliveryLease is how long a claimed delivery is hidden from
+	// other dispatchers. It outlasts the timeout, so a delivery is only
+	// claimed again if the server sending it stopped.
+	webhookDeliveryLease = time.Minute
+	webhookDeliveryBatch = 20
+
+	maxWebhookDeliveryAttempts = 8
+	webhookRetryBaseDelay      = 30 * time.Second
+	webhookRetryMaxDelay       = 6 * time.Hour
+	// webhookEndpointFailureLimit is how many deliveries in a row can fail
+	// before an endpoint is disabled.
+	webhookEndpointFailureLimit = 20
+
+	maxWebhookEndpoints          = 10
+	maxWebhookDeliveriesListed   = 50
+	maxWebhookResponseBodyStored = 1024
+	webhookDeliveryRetention     = 30 * 24 * time.Hour
+)
+
+// webhookEventTypes are the events endpoints can subscribe to. Chirpy has
+// no follows, and users have no handles to mention, so there are no
+// follow.created or user.mentioned events yet. Adding one means writing it
+// to the outbox where it happens and listing it here.
+var webhookEventTypes = []string{eventChirpCreated, eventChirpDeleted}
+
+// outboundWebhookEvent is the payload of every delivery.
+type outboundWebhookEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type WebhookEndpoint struct {
+	Id                  uuid.UUID  `json:"id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	Url                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	// Secret is only included in the response that creates it.
+	Secret string `json:"secret,omitempty"`
+}
+
+func webhookEndpointFromDB(endpoint database.WebhookEndpoint) WebhookEndpoint {
+	e := WebhookEndpoint{
+		Id:                  endpoint.ID,
+		CreatedAt:           endpoint.CreatedAt,
+		UpdatedAt:           endpoint.UpdatedAt,
+		Url:                 endpoint.Url,
+		EventTypes:          endpoint.EventTypes,
+		ConsecutiveFailures: endpoint.ConsecutiveFailures,
+		DisabledReason:      endpoint.DisabledReason.String,
+	}
+	if endpoint.DisabledAt.Valid {
+		e.DisabledAt = &endpoint.DisabledAt.Time
+	}
+	return e
+}
+
+type WebhookDelivery struct {
+	Id             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus int32           `json:"response_status,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+func webhookDeliveryFromDB(delivery database.WebhookDelivery) WebhookDelivery {
+	d := WebhookDelivery{
+		Id:             delivery.ID,
+		CreatedAt:      delivery.CreatedAt,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus.Int32,
+		ResponseBody:   delivery.ResponseBody.String,
+		Error:          delivery.Error.String,
+		Payload:        delivery.Payload,
+	}
+	if delivery.Status == webhookDeliveryPending {
+		d.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastAttemptAt.Valid {
+		d.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.DeliveredAt.Valid {
+		d.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+	return d
+}
+
+// outboundDelivery is everything needed to attempt a delivery.
+type outboundDelivery struct {
+	id         uuid.UUID
+	endpointID uuid.UUID
+	eventID    uuid.UUID
+	eventType  string
+	payload    []byte
+	attempts   int32
+	url        string
+	secret     string
+}
+
+// validateWebhookURL checks that raw is an absolute HTTP(S) URL. Where it
+// points is checked when connecting, since DNS can change in between.
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("URL must use http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("URL must have a host")
+	}
+	if u.User != nil {
+		return errors.New("URL mustn't contain credentials")
+	}
+	return nil
+}
+
+// webhookRetryDelay is how long to wait before the next attempt after
+// attempts have failed, doubling each time up to webhookRetryMaxDelay.
+func webhookRetryDelay(attempts int32) time.Duration {
+	delay := webhookRetryBaseDelay
+	for i := int32(1); i < attempts && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookRetryMaxDelay)
+}
+
+// queueWebhookDeliveries queues a delivery of an event to each of the
+// user's endpoints subscribed to it. Deliveries are keyed by the event, so
+// an event relayed twice is still only delivered once.
+func (cfg *apiConfig) queueWebhookDeliveries(ctx context.Context, event outbox.Event) error {
+	endpoints, err := cfg.db.ListWebhookEndpointsForEvent(ctx, database.ListWebhookEndpointsForEventParams{
+		UserID:    event.UserID,
+		EventType: event.Type,
+	})
+	if err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(outboundWebhookEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		if err := cfg.db.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EndpointID: endpoint.ID,
+			EventID:    event.ID,
+			EventType:  event.Type,
+			Payload:    payload,
+		}); err != nil {
+			return fmt.Errorf("couldn't queue delivery to webhook endpoint %s: %w", endpoint.ID, err)
+		}
+	}
+	return nil
+}
+
+// runWebhookDispatcher sends queued deliveries every interval until ctx is
+// done. Several servers can run it at once; each delivery is claimed by one
+// of them.
+func (cfg *apiConfig) runWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := cfg.dispatchWebhooks(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Couldn't dispatch webhooks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchWebhooks sends every delivery that is due, a batch at a time.
+func (cfg *apiConfig) dispatchWebhooks(ctx context.Context) error {
+	for {
+		claimed, err := cfg.db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+			LockedUntil:   nullTime(time.Now().UTC().Add(webhookDeliveryLease)),
+			MaxDeliveries: webhookDeliveryBatch,
+		})
+		if err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		for _, row := range claimed {
+			wg.Go(func() {
+				cfg.attemptWebhookDelivery(ctx, outboundDelivery{
+					id:         row.ID,
+					endpointID: row.EndpointID,
+					eventID:    row.EventID,
+					eventType:  row.EventType,
+					payload:    row.Payload,
+					attempts:   row.Attempts,
+					url:        row.Url,
+					secret:     row.Secret,
+				}, true)
+			})
+		}
+		wg.Wait()
+
+		if len(claimed) < webhookDeliveryBatch {
+			return ctx.Err()
+		}
+	}
+}
+
+// attemptWebhookDelivery sends a delivery once and records how it went.
+// Failed deliveries are retried later if retry is set and attempts remain.
+func (cfg *apiConfig) attemptWebhookDelivery(ctx context.Context, d outboundDelivery, retry bool) (database.WebhookDelivery, error) {
+	responseStatus, responseBody, sendErr := cfg.sendWebhook(ctx, d)
+	// The outcome is recorded even if the server is shutting down, so the
+	// delivery isn't sent again once its lease runs out.
+	ctx = context.WithoutCancel(ctx)
+
+	params := database.RecordWebhookDeliveryAttemptParams{
+		ID:             d.id,
+		Status:         webhookDeliveryDelivered,
+		NextAttemptAt:  time.Now().UTC(),
+		ResponseStatus: sql.NullInt32{Int32: int32(responseStatus), Valid: responseStatus != 0},
+		ResponseBody:   sql.NullString{String: responseBody, Valid: responseStatus != 0},
+	}
+	if sendErr != nil {
+		params.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+		params.Status = webhookDeliveryFailed
+		if attempts := d.attempts + 1; retry && attempts < maxWebhookDeliveryAttempts {
+			params.Status = webhookDeliveryPending
+			params.NextAttemptAt = params.NextAttemptAt.Add(webhookRetryDelay(attempts))
+		}
+	}
+	delivery, err := cfg.db.RecordWebhookDeliveryAttempt(ctx, params)
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't record attempt of webhook delivery", "delivery_id", d.id, "error", err)
+		return database.WebhookDelivery{}, err
+	}
+
+	if sendErr == nil {
+		if err := cfg.db.RecordWebhookEndpointSuccess(ctx, d.endpointID); err != nil {
+			logging.FromContext(ctx).Error("Couldn't reset failures of webhook endpoint", "endpoint_id", d.endpointID, "error", err)
+		}
+		return delivery, nil
+	}
+	failures, err := cfg.db.RecordWebhookEndpointFailure(ctx, d.endpointID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't count failure of webhook endpoint", "endpoint_id", d.endpointID, "error", err)
+		return delivery, nil
+	}
+	if failures >= webhookEndpointFailureLimit {
+		cfg.disableWebhookEndpoint(ctx, d.endpointID, failures)
+	}
+	return delivery, nil
+}
+
+// sendWebhook posts a signed delivery. Responses outside 2xx are errors.
+func (cfg *apiConfig) sendWebhook(ctx context.Context, d outboundDelivery) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set("Chirpy-Event", d.eventType)
+	req.Header.Set("Chirpy-Delivery", d.id.String())
+	req.Header.Set("Chirpy-Signature", webhook.Sign(d.secret, time.Now(), d.payload))
+
+	resp, err := cfg.webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBodyStored))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(body), fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// disableWebhookEndpoint stops deliveries to an endpoint that keeps failing
+// and tells its owner. Queued deliveries are kept, and resume if the owner
+// enables it again.
+func (cfg *apiConfig) disableWebhookEndpoint(ctx context.Context, endpointID uuid.UUID, failures int32) {
+	reason := fmt.Sprintf("%d deliveries in a row failed", failures)
+	endpoint, err := cfg.db.DisableWebhookEndpoint(ctx, database.DisableWebhookEndpointParams{
+		ID:             endpointID,
+		DisabledReason: sql.NullString{String: reason, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// It was already disabled.
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't disable webhook endpoint", "endpoint_id", endpointID, "error", err)
+		return
+	}
+	logging.FromContext(ctx).Info("Disabled webhook endpoint", "endpoint_id", endpointID, "reason", reason)
+
+	dbUser, err := cfg.db.GetUserById(ctx, endpoint.UserID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't get owner of webhook endpoint", "endpoint_id", endpointID, "error", err)
+		return
+	}
+	cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Your Chirpy webhook was disabled",
+		Body: fmt.Sprintf(
+			"We stopped sending webhooks to %s because %s. Events are still queued for it; once it's working again, enable it to receive them.\n",
+			endpoint.Url,
+			reason,
+		),
+	})
+}
+
+func (cfg *apiConfig) handlerCreateWebhookEndpoint() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		type parameters struct {
+			Url        string   `json:"url"`
+			EventTypes []string `json:"event_types"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		if err := validateWebhookURL(params.Url); err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid URL", err)
+			return
+		}
+		if len(params.EventTypes) == 0 {
+			respondWithError(w, r, http.StatusBadRequest, "At least one event type is required", nil)
+			return
+		}
+		for _, eventType := range params.EventTypes {
+			if !slices.Contains(webhookEventTypes, eventType) {
+				respondWithError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Unknown event type %s; expected one of %v", eventType, webhookEventTypes), nil)
+				return
+			}
+		}
+
+		existing, err := cfg.db.ListWebhookEndpoints(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create webhook endpoint", err)
+			return
+		}
+		if len(existing) >= maxWebhookEndpoints {
+			respondWithError(w, r, http.StatusConflict, fmt.Sprintf("You can have at most %d webhook endpoints", maxWebhookEndpoints), nil)
+			return
+		}
+
+		slices.Sort(params.EventTypes)
+		secret := webhook.NewSecret()
+		endpoint, err := cfg.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+			UserID:     userID,
+			Url:        params.Url,
+			Secret:     secret,
+			EventTypes: slices.Compact(params.EventTypes),
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create webhook endpoint", err)
+			return
+		}
+
+		response := webhookEndpointFromDB(endpoint)
+		response.Secret = secret
+		respondWithJSON(w, http.StatusCreated, response)
+	})
+}
+
+func (cfg *apiConfig) handlerListWebhookEndpoints() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		dbEndpoints, err := cfg.db.ListWebhookEndpoints(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't list webhook endpoints", err)
+			return
+		}
+
+		endpoints := []WebhookEndpoint{}
+		for _, dbEndpoint := range dbEndpoints {
+			endpoints = append(endpoints, webhookEndpointFromDB(dbEndpoint))
+		}
+		respondWithJSON(w, http.StatusOK, endpoints)
+	})
+}
+
+func (cfg *apiConfig) handlerDeleteWebhookEndpoint() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid webhook endpoint ID", err)
+			return
+		}
+
+		deleted, err := cfg.db.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+			ID:     endpointID,
+			UserID: userID,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't delete webhook endpoint", err)
+			return
+		}
+		if deleted == 0 {
+			respondWithError(w, r, http.StatusNotFound, "Webhook endpoint not found", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handlerEnableWebhookEndpoint resumes deliveries to an endpoint that was
+// disabled after failing too often.
+func (cfg *apiConfig) handlerEnableWebhookEndpoint() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid webhook endpoint ID", err)
+			return
+		}
+
+		params := database.EnableWebhookEndpointParams{ID: endpointID, UserID: userID}
+		enabled, err := cfg.db.EnableWebhookEndpoint(r.Context(), params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't enable webhook endpoint", err)
+			return
+		}
+		if enabled == 0 {
+			respondWithError(w, r, http.StatusNotFound, "Webhook endpoint not found", nil)
+			return
+		}
+		endpoint, err := cfg.db.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams(params))
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get webhook endpoint", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, webhookEndpointFromDB(endpoint))
+	})
+}
+
+// getWebhookEndpoint returns the user's endpoint named in the path, or
+// responds with an error and returns false.
+func (cfg *apiConfig) getWebhookEndpoint(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid webhook endpoint ID", err)
+		return database.WebhookEndpoint{}, false
+	}
+	endpoint, err := cfg.db.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusNotFound, "Webhook endpoint not found", err)
+		return database.WebhookEndpoint{}, false
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Couldn't get webhook endpoint", err)
+		return database.WebhookEndpoint{}, false
+	}
+	return endpoint, true
+}
+
+func (cfg *apiConfig) handlerListWebhookDeliveries() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := cfg.getWebhookEndpoint(w, r)
+		if !ok {
+			return
+		}
+
+		dbDeliveries, err := cfg.db.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+			EndpointID: endpoint.ID,
+			Limit:      maxWebhookDeliveriesListed,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't list webhook deliveries", err)
+			return
+		}
+
+		deliveries := []WebhookDelivery{}
+		for _, dbDelivery := range dbDeliveries {
+			deliveries = append(deliveries, webhookDeliveryFromDB(dbDelivery))
+		}
+		respondWithJSON(w, http.StatusOK, deliveries)
+	})
+}
+
+// handlerRedeliverWebhook sends a finished delivery again right away, such
+// as one that failed before the receiver was fixed. It is attempted once,
+// and isn't retried if it fails again.
+func (cfg *apiConfig) handlerRedeliverWebhook() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := cfg.getWebhookEndpoint(w, r)
+		if !ok {
+			return
+		}
+
+		deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid webhook delivery ID", err)
+			return
+		}
+		delivery, err := cfg.db.GetWebhookDelivery(r.Context(), database.GetWebhookDeliveryParams{
+			ID:         deliveryID,
+			EndpointID: endpoint.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Webhook delivery not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get webhook delivery", err)
+			return
+		}
+		if delivery.Status == webhookDeliveryPending {
+			respondWithError(w, r, http.StatusConflict, "Delivery is still queued", nil)
+			return
+		}
+
+		delivery, err = cfg.attemptWebhookDelivery(r.Context(), outboundDelivery{
+			id:         delivery.ID,
+			endpointID: endpoint.ID,
+			eventID:    delivery.EventID,
+			eventType:  delivery.EventType,
+			payload:    delivery.Payload,
+			attempts:   delivery.Attempts,
+			url:        endpoint.Url,
+			secret:     endpoint.Secret,
+		}, false)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't record delivery", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, webhookDeliveryFromDB(delivery))
+	})
+}
+
+// purgeWebhookDeliveries deletes finished deliveries past their retention
+// period.
+func (cfg *apiConfig) purgeWebhookDeliveries(ctx context.Context) error {
+	deleted, err := cfg.db.DeleteWebhookDeliveriesBefore(ctx, time.Now().UTC().Add(-webhookDeliveryRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Deleted webhook deliveries", "count", deleted)
+	}
+	return nil
+}
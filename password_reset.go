@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+	"github.com/gyulaieric/chirpy/internal/validation"
+)
+
+const passwordResetLifetime = time.Hour
+
+func (cfg *apiConfig) handlerForgotPassword() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Email string `json:"email"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		// Respond the same way whether or not the account exists, so this
+		// endpoint can't be used to find out who has an account.
+		dbUser, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Couldn't look up user for password reset", "error", err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		token := auth.MakeSignedToken(cfg.jwtSecret)
+		if err := cfg.db.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashToken(token),
+			UserID:    dbUser.ID,
+			ExpiresAt: time.Now().UTC().Add(passwordResetLifetime),
+		}); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create password reset token", err)
+			return
+		}
+
+		link := cfg.baseURL + "/app/reset-password.html?token=" + url.QueryEscape(token)
+		cfg.sendMail(mailer.Message{
+			To:      dbUser.Email,
+			Subject: "Reset your Chirpy password",
+			Body: fmt.Sprintf(
+				"Someone asked to reset the password for your Chirpy account. Open the link below to choose a new one:\n\n%s\n\nThe link expires in 1 hour and can only be used once. If you didn't ask for this, you can ignore this email.\n",
+				link,
+			),
+		})
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func (cfg *apiConfig) handlerResetPassword() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		if !auth.ValidSignedToken(cfg.jwtSecret, params.Token) {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid or expired password reset token", nil)
+			return
+		}
+
+		// Check the new password before using up the token, so that a
+		// rejected password doesn't require requesting another email.
+		tokenHash := auth.HashToken(params.Token)
+		resetToken, err := cfg.db.GetValidPasswordResetToken(r.Context(), tokenHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid or expired password reset token", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't reset password", err)
+			return
+		}
+		dbUser, err := cfg.db.GetUserById(r.Context(), resetToken.UserID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't reset password", err)
+			return
+		}
+		var errs validation.Errors
+		for _, problem := range cfg.passwordPolicy.Validate(params.Password, dbUser.Email) {
+			errs.Add("password", problem)
+		}
+		if len(errs) > 0 {
+			respondWithValidationErrors(w, errs)
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+
+		if _, err := cfg.db.UsePasswordResetToken(r.Context(), tokenHash); errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid or expired password reset token", err)
+			return
+		} else if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't reset password", err)
+			return
+		}
+
+		if err := cfg.db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             resetToken.UserID,
+			HashedPassword: hashedPassword,
+		}); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't reset password", err)
+			return
+		}
+
+		// Whoever knew the old password shouldn't stay logged in.
+		if err := cfg.db.RevokeAllRefreshTokensForUser(r.Context(), resetToken.UserID); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke existing sessions", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPasswordReset(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	user, credentials := createTestUser(t, chirpy.URL)
+	mail := make(chanMailer, 10)
+	cfg.mailer = mail
+
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/password/forgot", "", map[string]string{"email": user.Email}, nil); code != http.StatusAccepted {
+		t.Fatalf("forgot password status = %d, want %d", code, http.StatusAccepted)
+	}
+	link := receiveLink(t, mail)
+
+	// The link opens a page that asks for the new password.
+	resp, err := http.Get(chirpy.URL + link.RequestURI())
+	if err != nil {
+		t.Fatalf("GET %s: %v", link.Path, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("GET %s = %d %s, want an HTML page", link.Path, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	reset := map[string]string{"token": link.Query().Get("token"), "password": "a brand new passphrase"}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/password/reset", "", reset, nil); code != http.StatusNoContent {
+		t.Fatalf("reset status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/password/reset", "", reset, nil); code != http.StatusBadRequest {
+		t.Errorf("second reset status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, nil); code != http.StatusUnauthorized {
+		t.Errorf("login with old password status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	credentials["password"] = reset["password"]
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, nil); code != http.StatusOK {
+		t.Errorf("login with new password status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/database"
+)
+
+const (
+	defaultPersonalAccessTokenDays = 30
+	maxPersonalAccessTokenDays     = 365
+)
+
+type PersonalAccessToken struct {
+	Id         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Token is only included in the response that creates it.
+	Token string `json:"token,omitempty"`
+}
+
+func personalAccessTokenFromDB(pat database.PersonalAccessToken) PersonalAccessToken {
+	token := PersonalAccessToken{
+		Id:        pat.ID,
+		CreatedAt: pat.CreatedAt,
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+		ExpiresAt: pat.ExpiresAt,
+	}
+	if pat.LastUsedAt.Valid {
+		token.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	if pat.RevokedAt.Valid {
+		token.RevokedAt = &pat.RevokedAt.Time
+	}
+	return token
+}
+
+func (cfg *apiConfig) handlerCreatePersonalAccessToken() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		type parameters struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays int      `json:"expires_in_days"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+
+		if params.Name == "" {
+			respondWithError(w, r, http.StatusBadRequest, "Token name is required", nil)
+			return
+		}
+		if len(params.Scopes) == 0 {
+			respondWithError(w, r, http.StatusBadRequest, "At least one scope is required", nil)
+			return
+		}
+		for _, scope := range params.Scopes {
+			if !auth.IsGrantableScope(scope) {
+				respondWithError(w, r, http.StatusBadRequest, "Unknown scope: "+scope, nil)
+				return
+			}
+			if scope == auth.ScopeAdmin && !principal.HasRole(auth.RoleAdmin) {
+				respondWithError(w, r, http.StatusForbidden, "Only admins can create tokens with the admin scope", nil)
+				return
+			}
+		}
+		if params.ExpiresInDays == 0 {
+			params.ExpiresInDays = defaultPersonalAccessTokenDays
+		}
+		if params.ExpiresInDays < 0 || params.ExpiresInDays > maxPersonalAccessTokenDays {
+			respondWithError(w, r, http.StatusBadRequest, "expires_in_days must be between 1 and 365", nil)
+			return
+		}
+
+		slices.Sort(params.Scopes)
+		token := auth.MakePersonalAccessToken()
+		pat, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+			UserID:    principal.UserID,
+			Name:      params.Name,
+			TokenHash: auth.HashToken(token),
+			Scopes:    slices.Compact(params.Scopes),
+			ExpiresAt: time.Now().UTC().AddDate(0, 0, params.ExpiresInDays),
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't create token", err)
+			return
+		}
+
+		response := personalAccessTokenFromDB(pat)
+		response.Token = token
+		respondWithJSON(w, http.StatusCreated, response)
+	})
+}
+
+func (cfg *apiConfig) handlerListPersonalAccessTokens() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		dbTokens, err := cfg.db.ListPersonalAccessTokens(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't fetch tokens from database", err)
+			return
+		}
+		tokens := []PersonalAccessToken{}
+		for _, dbToken := range dbTokens {
+			tokens = append(tokens, personalAccessTokenFromDB(dbToken))
+		}
+		respondWithJSON(w, http.StatusOK, tokens)
+	})
+}
+
+func (cfg *apiConfig) handlerRevokePersonalAccessToken() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, "Not authenticated", nil)
+			return
+		}
+
+		tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Couldn't parse UUID from path parameter", err)
+			return
+		}
+
+		rows, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+			ID:     tokenID,
+			UserID: userID,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't revoke token", err)
+			return
+		}
+		if rows == 0 {
+			respondWithError(w, r, http.StatusNotFound, "Token not found", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
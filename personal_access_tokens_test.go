@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	chirpy, _ := newTestServer(t)
+	user, _ := createTestUser(t, chirpy.URL)
+
+	var pat PersonalAccessToken
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/tokens", user.Token, map[string]any{
+		"name":   "Poster",
+		"scopes": []string{auth.ScopeChirpsWrite},
+	}, &pat); code != http.StatusCreated {
+		t.Fatalf("create token status = %d, want %d", code, http.StatusCreated)
+	}
+
+	var chirp Chirp
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/chirps", pat.Token, map[string]string{"body": "Hello"}, &chirp); code != http.StatusCreated {
+		t.Fatalf("create chirp status = %d, want %d", code, http.StatusCreated)
+	}
+	// Reading chirps is open to anyone, but not to tokens without chirps:read.
+	for _, path := range []string{"/api/chirps", "/api/chirps/" + chirp.Id.String()} {
+		if code := doJSON(t, http.MethodGet, chirpy.URL+path, "", nil, nil); code != http.StatusOK {
+			t.Errorf("anonymous GET %s status = %d, want %d", path, code, http.StatusOK)
+		}
+		if code := doJSON(t, http.MethodGet, chirpy.URL+path, pat.Token, nil, nil); code != http.StatusForbidden {
+			t.Errorf("GET %s without chirps:read status = %d, want %d", path, code, http.StatusForbidden)
+		}
+		if code := doJSON(t, http.MethodGet, chirpy.URL+path, user.Token, nil, nil); code != http.StatusOK {
+			t.Errorf("GET %s with a first-party token status = %d, want %d", path, code, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/polkasim"
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+func postPolkaWebhook(t *testing.T, url, signature string, body []byte) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url+"/api/polka/webhooks", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set("Polka-Signature", signature)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /api/polka/webhooks: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestPolkaWebhookSignatures(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	cfg.polkaWebhookSecret = "test-webhook-secret"
+
+	register := func() User {
+		credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+		doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+		var user User
+		if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+			t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+		}
+		return user
+	}
+	isChirpyRed := func(user User) bool {
+		dbUser, err := cfg.db.GetUserById(context.Background(), user.Id)
+		if err != nil {
+			t.Fatalf("Couldn't get user: %v", err)
+		}
+		return dbUser.IsChirpyRed
+	}
+	event := func(id string, user User) []byte {
+		body, _ := json.Marshal(map[string]any{
+			"id":    id,
+			"event": "user.upgraded",
+			"data":  map[string]string{"user_id": user.Id.String()},
+		})
+		return body
+	}
+
+	alice, bob := register(), register()
+	eventID := uuid.NewString()
+	body := event(eventID, alice)
+
+	if code := postPolkaWebhook(t, chirpy.URL, "", body); code != http.StatusUnauthorized {
+		t.Errorf("unsigned webhook status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign("wrong-secret", time.Now(), body), body); code != http.StatusUnauthorized {
+		t.Errorf("wrongly signed webhook status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now().Add(-time.Hour), body), body); code != http.StatusUnauthorized {
+		t.Errorf("stale webhook status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if isChirpyRed(alice) {
+		t.Fatalf("rejected webhooks upgraded the user")
+	}
+
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), body), body); code != http.StatusNoContent {
+		t.Fatalf("signed webhook status = %d, want %d", code, http.StatusNoContent)
+	}
+	if !isChirpyRed(alice) {
+		t.Errorf("signed webhook didn't upgrade the user")
+	}
+
+	// A second delivery of the same event is acknowledged but not applied.
+	replay := event(eventID, bob)
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), replay), replay); code != http.StatusNoContent {
+		t.Errorf("replayed webhook status = %d, want %d", code, http.StatusNoContent)
+	}
+	if isChirpyRed(bob) {
+		t.Errorf("replayed webhook was applied again")
+	}
+
+	// A delivery that fails isn't recorded as processed, so it's applied
+	// when Polka retries it.
+	failedID := uuid.NewString()
+	failed := event(failedID, User{Id: uuid.New()})
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), failed), failed); code != http.StatusNotFound {
+		t.Errorf("webhook for unknown user status = %d, want %d", code, http.StatusNotFound)
+	}
+	retry := event(failedID, bob)
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), retry), retry); code != http.StatusNoContent {
+		t.Errorf("retried webhook status = %d, want %d", code, http.StatusNoContent)
+	}
+	if !isChirpyRed(bob) {
+		t.Errorf("retried webhook wasn't applied")
+	}
+}
+
+func TestPolkaSimScenarios(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	cfg.polkaWebhookSecret = "test-webhook-secret"
+	client := &polkasim.Client{BaseURL: chirpy.URL, Secret: cfg.polkaWebhookSecret}
+
+	for _, scenario := range polkasim.Scenarios {
+		t.Run(scenario.Name, func(t *testing.T) {
+			credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+			var user User
+			if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, &user); code != http.StatusCreated {
+				t.Fatalf("register status = %d, want %d", code, http.StatusCreated)
+			}
+			for _, d := range scenario.Deliveries(user.Id.String(), time.Now()) {
+				status, err := client.Send(context.Background(), d)
+				if err != nil {
+					t.Fatalf("Send() error = %v", err)
+				}
+				if status != d.Expect {
+					t.Errorf("%s: status = %d, want %d", d.Description, status, d.Expect)
+				}
+			}
+		})
+	}
+}
@@ -10,7 +10,7 @@ func (cfg *apiConfig) handlerReset() http.Handler {
 		}
 		cfg.fileserverHits.Store(0)
 		if err := cfg.db.DeleteUsers(r.Context()); err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't delete users", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't delete users", err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
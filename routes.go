@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+	"github.com/gyulaieric/chirpy/internal/logging"
+)
+
+func (cfg *apiConfig) routes(filepathRoot http.FileSystem) http.Handler {
+	mux := http.NewServeMux()
+
+	// requireScope authenticates the request and checks that its credential
+	// carries scope. First-party access tokens carry every scope.
+	requireScope := func(scope string, next http.Handler) http.Handler {
+		return cfg.middlewareAuth(middlewareRequireScope(scope, next))
+	}
+	// optionalScope is requireScope for routes anonymous users can also use.
+	optionalScope := func(scope string, next http.Handler) http.Handler {
+		return cfg.middlewareOptionalAuth(middlewareOptionalScope(scope, next))
+	}
+	requireAdmin := func(next http.Handler) http.Handler {
+		return requireScope(auth.ScopeAdmin, middlewareRequireRole(auth.RoleAdmin, next))
+	}
+
+	// API
+	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+
+	mux.Handle("POST /api/users", cfg.handlerRegister())
+	mux.Handle("GET /api/users/me", requireScope(auth.ScopeProfileRead, cfg.handlerGetCurrentUser()))
+	mux.Handle("PUT /api/users", requireScope(auth.ScopeProfileWrite, cfg.handlerUpdateUsers()))
+	mux.Handle("DELETE /api/users/me", requireScope(auth.ScopeAccount, cfg.handlerDeleteAccount()))
+
+	mux.Handle("POST /api/users/me/export", requireScope(auth.ScopeAccount, cfg.handlerRequestDataExport()))
+	mux.Handle("GET /api/users/me/exports/{exportID}", requireScope(auth.ScopeAccount, cfg.handlerGetDataExport()))
+	mux.Handle("GET /api/exports/{exportID}/download", cfg.handlerDownloadDataExport())
+
+	mux.Handle("GET /api/users/verify", cfg.handlerVerifyEmail())
+	mux.Handle("POST /api/users/me/verification", requireScope(auth.ScopeAccount, cfg.handlerResendVerification()))
+
+	mux.Handle("POST /api/password/forgot", cfg.handlerForgotPassword())
+	mux.Handle("POST /api/password/reset", cfg.handlerResetPassword())
+
+	mux.Handle("POST /api/users/me/mfa", requireScope(auth.ScopeAccount, cfg.handlerEnrollMFA()))
+	mux.Handle("POST /api/users/me/mfa/confirm", requireScope(auth.ScopeAccount, cfg.handlerConfirmMFA()))
+	mux.Handle("DELETE /api/users/me/mfa", requireScope(auth.ScopeAccount, cfg.handlerDisableMFA()))
+
+	mux.Handle("POST /api/login", cfg.handlerLogin())
+	mux.Handle("POST /api/login/mfa", cfg.handlerLoginMFA())
+	mux.Handle("POST /api/login/magic", cfg.handlerRequestMagicLink())
+	mux.Handle("POST /api/login/magic/redeem", cfg.handlerRedeemMagicLink())
+	mux.Handle("GET /api/login/oidc", cfg.handlerOIDCLogin())
+	mux.Handle("GET /api/login/oidc/callback", cfg.handlerOIDCCallback())
+
+	mux.Handle("GET /api/users/me/login-history", requireScope(auth.ScopeAccount, cfg.handlerLoginHistory()))
+	mux.Handle("POST /api/login-history/revoke", cfg.handlerRevokeLoginSession())
+
+	mux.Handle("POST /api/tokens", requireScope(auth.ScopeAccount, cfg.handlerCreatePersonalAccessToken()))
+	mux.Handle("GET /api/tokens", requireScope(auth.ScopeAccount, cfg.handlerListPersonalAccessTokens()))
+	mux.Handle("DELETE /api/tokens/{tokenID}", requireScope(auth.ScopeAccount, cfg.handlerRevokePersonalAccessToken()))
+
+	mux.Handle("POST /api/refresh", cfg.handlerRefresh())
+	mux.Handle("POST /api/revoke", cfg.handlerRevoke())
+
+	mux.Handle("GET /api/chirps", optionalScope(auth.ScopeChirpsRead, cfg.handlerGetChirps()))
+	mux.Handle("GET /api/chirps/{chirpID}", optionalScope(auth.ScopeChirpsRead, cfg.handlerGetChirp()))
+	mux.Handle("POST /api/chirps", requireScope(auth.ScopeChirpsWrite, cfg.handlerCreateChirp()))
+	mux.Handle("PUT /api/chirps/{chirpID}", requireScope(auth.ScopeChirpsWrite, cfg.handlerUpdateChirp()))
+	mux.Handle("DELETE /api/chirps/{chirpID}", requireScope(auth.ScopeChirpsWrite, cfg.handlerDeleteChirp()))
+	mux.Handle("POST /api/chirps/import", requireScope(auth.ScopeChirpsWrite, cfg.handlerImportChirps()))
+
+	mux.Handle("POST /api/webhooks", requireScope(auth.ScopeWebhooks, cfg.handlerCreateWebhookEndpoint()))
+	mux.Handle("GET /api/webhooks", requireScope(auth.ScopeWebhooks, cfg.handlerListWebhookEndpoints()))
+	mux.Handle("DELETE /api/webhooks/{endpointID}", requireScope(auth.ScopeWebhooks, cfg.handlerDeleteWebhookEndpoint()))
+	mux.Handle("POST /api/webhooks/{endpointID}/enable", requireScope(auth.ScopeWebhooks, cfg.handlerEnableWebhookEndpoint()))
+	mux.Handle("GET /api/webhooks/{endpointID}/deliveries", requireScope(auth.ScopeWebhooks, cfg.handlerListWebhookDeliveries()))
+	mux.Handle("POST /api/webhooks/{endpointID}/deliveries/{deliveryID}/redeliver", requireScope(auth.ScopeWebhooks, cfg.handlerRedeliverWebhook()))
+
+	mux.Handle("POST /api/polka/webhooks", cfg.handlerPolkaWebhooks())
+
+	// ADMIN
+	mux.Handle("POST /admin/reset", cfg.handlerReset())
+	mux.Handle("GET /admin/metrics", cfg.handlerMetrics())
+	mux.Handle("DELETE /admin/lockouts", requireAdmin(cfg.handlerClearLockout()))
+	mux.Handle("DELETE /admin/users/{userID}", requireAdmin(cfg.handlerAdminDeleteUser()))
+	mux.Handle("GET /admin/webhook-events", requireAdmin(cfg.handlerAdminListWebhookEvents()))
+	mux.Handle("GET /admin/webhook-events/{eventID}", requireAdmin(cfg.handlerAdminGetWebhookEvent()))
+	mux.Handle("POST /admin/webhook-events/{eventID}/replay", requireAdmin(cfg.handlerAdminReplayWebhookEvent()))
+	mux.Handle("GET /admin/jobs", requireAdmin(cfg.handlerAdminListJobs()))
+	mux.Handle("GET /admin/jobs/{jobID}", requireAdmin(cfg.handlerAdminGetJob()))
+	mux.Handle("POST /admin/jobs/{jobID}/retry", requireAdmin(cfg.handlerAdminRetryJob()))
+
+	// OAuth
+	mux.Handle("POST /api/oauth/clients", requireScope(auth.ScopeAccount, cfg.handlerCreateOAuthClient()))
+	mux.Handle("GET /oauth/authorize", cfg.handlerAuthorizePage())
+	mux.Handle("POST /oauth/authorize", cfg.handlerAuthorize())
+	mux.Handle("POST /oauth/token", cfg.handlerOAuthToken())
+	mux.Handle("POST /oauth/revoke", cfg.handlerOAuthRevoke())
+
+	// File Server
+	mux.Handle(
+		"/app/",
+		cfg.middlewareMetricsInc(
+			http.StripPrefix(
+				"/app",
+				http.FileServer(filepathRoot),
+			),
+		),
+	)
+
+	return logging.Middleware(slog.Default(), mux)
+}
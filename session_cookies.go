@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gyulaieric/chirpy/internal/auth"
+)
+
+// Cookie sessions are an alternative to bearer tokens for the web app, which
+// keeps tokens out of reach of JavaScript. Since browsers send cookies on
+// their own, state-changing requests must also echo the CSRF cookie in the
+// X-CSRF-Token header, which other sites can't read.
+const (
+	accessTokenCookie  = "chirpy_access"
+	refreshTokenCookie = "chirpy_refresh"
+	csrfCookie         = "chirpy_csrf"
+	csrfHeader         = "X-CSRF-Token"
+
+	// The refresh token cookie is only needed by /api/refresh and
+	// /api/revoke.
+	refreshTokenCookiePath = "/api"
+
+	// webAppPath is where the web app is served from.
+	webAppPath = "/app/"
+
+	sessionAccessTokenLifetime = 15 * time.Minute
+	refreshTokenLifetime       = 60 * 24 * time.Hour
+)
+
+var errInvalidCSRFToken = errors.New("missing or invalid CSRF token")
+
+// secureCookies is false only when Chirpy is served over plain HTTP, as in
+// local development, where browsers would drop Secure cookies.
+func (cfg *apiConfig) secureCookies() bool {
+	return !strings.HasPrefix(cfg.baseURL, "http://")
+}
+
+func (cfg *apiConfig) sessionCookie(name, value, path string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func (cfg *apiConfig) setAccessTokenCookie(w http.ResponseWriter, accessToken string) {
+	http.SetCookie(w, cfg.sessionCookie(accessTokenCookie, accessToken, "/", sessionAccessTokenLifetime))
+}
+
+// setSessionCookies starts a cookie session with a fresh CSRF token.
+func (cfg *apiConfig) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken string) {
+	cfg.setAccessTokenCookie(w, accessToken)
+	http.SetCookie(w, cfg.sessionCookie(refreshTokenCookie, refreshToken, refreshTokenCookiePath, refreshTokenLifetime))
+
+	// The web app reads the CSRF token from its cookie, so it can't be
+	// HttpOnly.
+	csrf := cfg.sessionCookie(csrfCookie, auth.MakeRefreshToken(), "/", refreshTokenLifetime)
+	csrf.HttpOnly = false
+	http.SetCookie(w, csrf)
+}
+
+func (cfg *apiConfig) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, cfg.sessionCookie(accessTokenCookie, "", "/", -time.Second))
+	http.SetCookie(w, cfg.sessionCookie(refreshTokenCookie, "", refreshTokenCookiePath, -time.Second))
+	csrf := cfg.sessionCookie(csrfCookie, "", "/", -time.Second)
+	csrf.HttpOnly = false
+	http.SetCookie(w, csrf)
+}
+
+// validCSRFToken checks the double-submitted CSRF token on requests that can
+// change state.
+func validCSRFToken(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(csrfHeader))) == 1
+}
+
+// sessionToken returns the token stored in a session cookie, checking the
+// CSRF token first. It returns auth.ErrNoAuthorizationHeader when there is no
+// such cookie, so callers can treat the request as not authenticated.
+func sessionToken(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", auth.ErrNoAuthorizationHeader
+	}
+	if !validCSRFToken(r) {
+		return "", errInvalidCSRFToken
+	}
+	return cookie.Value, nil
+}
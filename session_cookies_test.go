@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidCSRFToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		want   bool
+	}{
+		{
+			name:   "Safe method needs no token",
+			method: http.MethodGet,
+			want:   true,
+		},
+		{
+			name:   "Matching token",
+			method: http.MethodPost,
+			cookie: "token",
+			header: "token",
+			want:   true,
+		},
+		{
+			name:   "Missing header",
+			method: http.MethodPost,
+			cookie: "token",
+			want:   false,
+		},
+		{
+			name:   "Mismatched header",
+			method: http.MethodDelete,
+			cookie: "token",
+			header: "other",
+			want:   false,
+		},
+		{
+			name:   "Missing cookie",
+			method: http.MethodPut,
+			header: "token",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/chirps", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, tt.header)
+			}
+			if got := validCSRFToken(r); got != tt.want {
+				t.Errorf("validCSRFToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCookieSession(t *testing.T) {
+	chirpy, _ := newTestServer(t)
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	chirpyURL, _ := url.Parse(chirpy.URL)
+
+	send := func(method, path string, body any, withCSRF bool) *http.Response {
+		t.Helper()
+		var reqBody bytes.Buffer
+		json.NewEncoder(&reqBody).Encode(body)
+		req, _ := http.NewRequest(method, chirpy.URL+path, &reqBody)
+		if withCSRF {
+			for _, cookie := range jar.Cookies(chirpyURL) {
+				if cookie.Name == csrfCookie {
+					req.Header.Set(csrfHeader, cookie.Value)
+				}
+			}
+		}
+		resp, err := browser.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	email := uuid.NewString() + "@example.com"
+	password := "correct horse battery staple"
+	send(http.MethodPost, "/api/users", map[string]string{"email": email, "password": password}, false)
+
+	var reqBody bytes.Buffer
+	json.NewEncoder(&reqBody).Encode(map[string]any{"email": email, "password": password, "use_cookies": true})
+	resp, err := browser.Post(chirpy.URL+"/api/login", "application/json", &reqBody)
+	if err != nil {
+		t.Fatalf("POST /api/login: %v", err)
+	}
+	var user User
+	json.NewDecoder(resp.Body).Decode(&user)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || user.Token != "" || user.RefreshToken != "" {
+		t.Fatalf("cookie login = %d %+v, want no tokens in the body", resp.StatusCode, user)
+	}
+
+	chirp := map[string]string{"body": "Posted from the web app"}
+	if resp := send(http.MethodPost, "/api/chirps", chirp, false); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("create chirp without CSRF token status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if resp := send(http.MethodPost, "/api/chirps", chirp, true); resp.StatusCode != http.StatusCreated {
+		t.Errorf("create chirp status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	if resp := send(http.MethodPost, "/api/refresh", nil, false); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("refresh without CSRF token status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if resp := send(http.MethodPost, "/api/refresh", nil, true); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("refresh status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+
+	if resp := send(http.MethodPost, "/api/revoke", nil, true); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("revoke status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if resp := send(http.MethodPost, "/api/chirps", chirp, true); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("create chirp after revoke status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
@@ -9,18 +9,48 @@ VALUES (
 )
 RETURNING *;
 
+-- name: ImportChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
 -- name: GetChirps :many
-SELECT * FROM chirps
-ORDER BY created_at;
+SELECT chirps.* FROM chirps
+    JOIN users ON users.id = chirps.user_id
+        WHERE users.deactivated_at IS NULL
+ORDER BY chirps.created_at;
 
 -- name: GetChirpsByUserId :many
-SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at;
+SELECT chirps.* FROM chirps
+    JOIN users ON users.id = chirps.user_id
+        WHERE chirps.user_id = $1
+        AND users.deactivated_at IS NULL
+ORDER BY chirps.created_at;
 
 -- name: GetChirp :one
-SELECT * FROM chirps
-WHERE id = $1;
+SELECT chirps.* FROM chirps
+    JOIN users ON users.id = chirps.user_id
+        WHERE chirps.id = $1
+        AND users.deactivated_at IS NULL;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+    SET body = $2,
+        updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: CountChirpsSince :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1
+AND created_at > $2;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
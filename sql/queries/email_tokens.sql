@@ -0,0 +1,66 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, created_at, user_id, email, expires_at, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    NULL
+);
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens
+    SET used_at = NOW()
+    WHERE token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, created_at, user_id, expires_at, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    NULL
+);
+
+-- name: GetValidPasswordResetToken :one
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW();
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+    SET used_at = NOW()
+    WHERE token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, created_at, user_id, email, expires_at, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    NULL
+);
+
+-- name: CountMagicLinkTokensSince :one
+SELECT COUNT(*) FROM magic_link_tokens
+WHERE user_id = $1
+AND created_at > $2;
+
+-- name: UseMagicLinkToken :one
+UPDATE magic_link_tokens
+    SET used_at = NOW()
+    WHERE token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,13 @@
+-- name: CreateImportedChirp :exec
+INSERT INTO imported_chirps (user_id, source_id, created_at, chirp_id)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3
+);
+
+-- name: GetImportedChirp :one
+SELECT * FROM imported_chirps
+WHERE user_id = $1
+AND source_id = $2;
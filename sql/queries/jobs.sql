@@ -0,0 +1,96 @@
+-- name: EnqueueJob :one
+INSERT INTO jobs (id, created_at, updated_at, kind, args, status, attempts, max_attempts, run_at, locked_until, unique_key, last_error, finished_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    'queued',
+    0,
+    $3,
+    $4,
+    NULL,
+    $5,
+    NULL,
+    NULL
+)
+ON CONFLICT (unique_key) WHERE status IN ('queued', 'running') DO NOTHING
+RETURNING *;
+
+-- name: ClaimJob :one
+UPDATE jobs
+    SET status = 'running',
+        attempts = attempts + 1,
+        locked_until = sqlc.arg(locked_until),
+        updated_at = NOW()
+    WHERE id = (
+        SELECT id FROM jobs
+        WHERE kind = ANY(sqlc.arg(kinds)::text[])
+        AND (
+            (status = 'queued' AND run_at <= NOW())
+            OR (status = 'running' AND locked_until < NOW())
+        )
+        ORDER BY run_at
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    )
+RETURNING *;
+
+-- name: CompleteJob :execrows
+UPDATE jobs
+    SET status = 'succeeded',
+        locked_until = NULL,
+        last_error = NULL,
+        finished_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1
+    AND status = 'running'
+    AND locked_until = $2;
+
+-- name: RetryJob :execrows
+UPDATE jobs
+    SET status = 'queued',
+        run_at = $2,
+        locked_until = NULL,
+        last_error = $3,
+        updated_at = NOW()
+    WHERE id = $1
+    AND status = 'running'
+    AND locked_until = $4;
+
+-- name: FailJob :execrows
+UPDATE jobs
+    SET status = 'failed',
+        locked_until = NULL,
+        last_error = $2,
+        finished_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1
+    AND status = 'running'
+    AND locked_until = $3;
+
+-- name: GetJob :one
+SELECT * FROM jobs
+WHERE id = $1;
+
+-- name: ListJobs :many
+SELECT * FROM jobs
+WHERE sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_jobs);
+
+-- name: RequeueJob :one
+UPDATE jobs
+    SET status = 'queued',
+        attempts = 0,
+        run_at = NOW(),
+        finished_at = NULL,
+        updated_at = NOW()
+    WHERE id = $1
+    AND status = 'failed'
+RETURNING *;
+
+-- name: DeleteJobsBefore :execrows
+DELETE FROM jobs
+WHERE finished_at < $1;
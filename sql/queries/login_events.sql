@@ -0,0 +1,54 @@
+-- name: CreateLoginEvent :exec
+INSERT INTO login_events (id, created_at, user_id, email, method, success, failure_reason, ip_address, network, user_agent, new_device, new_network, refresh_token_hash, revoke_token_hash, oauth_client_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12,
+    $13
+);
+
+-- name: GetLoginFamiliarity :one
+SELECT
+    COUNT(*) > 0 AS has_history,
+    COALESCE(bool_or(user_agent = sqlc.arg(user_agent)::text), false)::boolean AS known_device,
+    COALESCE(bool_or(network = sqlc.arg(network)::text), false)::boolean AS known_network
+FROM login_events
+WHERE user_id = sqlc.arg(user_id)
+AND success;
+
+-- name: GetLoginEventByRevokeToken :one
+SELECT * FROM login_events
+WHERE revoke_token_hash = $1;
+
+-- name: ListLoginEvents :many
+SELECT
+    login_events.*,
+    (
+        COALESCE(refresh_tokens.revoked_at IS NULL AND refresh_tokens.expires_at > NOW(), false)
+        -- OAuth logins are active while the app holds a refresh token.
+        OR EXISTS (
+            SELECT 1 FROM refresh_tokens AS grants
+            WHERE grants.user_id = login_events.user_id
+            AND grants.client_id = login_events.oauth_client_id
+            AND grants.revoked_at IS NULL
+            AND grants.expires_at > NOW()
+        )
+    )::boolean AS session_active
+FROM login_events
+LEFT JOIN refresh_tokens
+    ON refresh_tokens.user_id = login_events.user_id
+    AND encode(sha256(convert_to(refresh_tokens.token, 'UTF8')), 'hex') = login_events.refresh_token_hash
+WHERE login_events.user_id = $1
+ORDER BY login_events.created_at DESC
+LIMIT $2;
@@ -0,0 +1,33 @@
+-- name: GetActiveLockout :one
+SELECT * FROM login_throttles
+WHERE key = $1
+AND locked_until > NOW();
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (key, created_at, updated_at, failures, last_failure_at, locked_until)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    1,
+    NOW(),
+    NULL
+)
+ON CONFLICT (key) DO UPDATE
+    SET failures = CASE
+            WHEN login_throttles.last_failure_at < sqlc.arg(window_start) THEN 1
+            ELSE login_throttles.failures + 1
+        END,
+        last_failure_at = NOW(),
+        updated_at = NOW()
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_throttles
+    SET locked_until = $2,
+        updated_at = NOW()
+    WHERE key = $1;
+
+-- name: ClearLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE key = $1;
@@ -0,0 +1,60 @@
+-- name: UpsertPendingUserMFA :one
+INSERT INTO user_mfa (user_id, created_at, updated_at, secret, enabled_at, last_used_step)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    NULL,
+    0
+)
+ON CONFLICT (user_id) DO UPDATE
+    SET secret = EXCLUDED.secret,
+        updated_at = NOW(),
+        last_used_step = 0
+    WHERE user_mfa.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetUserMFA :one
+SELECT * FROM user_mfa
+WHERE user_id = $1;
+
+-- name: EnableUserMFA :execrows
+UPDATE user_mfa
+    SET enabled_at = NOW(),
+        last_used_step = $2,
+        updated_at = NOW()
+    WHERE user_id = $1
+    AND enabled_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_mfa
+    SET last_used_step = $2,
+        updated_at = NOW()
+    WHERE user_id = $1
+    AND enabled_at IS NOT NULL
+    AND last_used_step < $2;
+
+-- name: DeleteUserMFA :exec
+DELETE FROM user_mfa
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (code_hash, created_at, user_id, used_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    NULL
+);
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+    SET used_at = NOW()
+    WHERE code_hash = $1
+    AND user_id = $2
+    AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
@@ -0,0 +1,39 @@
+-- name: CreateOutboxEvent :one
+INSERT INTO outbox_events (id, created_at, event_type, user_id, payload, attempts, next_attempt_at, last_error, published_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    0,
+    NOW(),
+    NULL,
+    NULL
+)
+RETURNING *;
+
+-- name: ListPendingOutboxEvents :many
+SELECT * FROM outbox_events
+WHERE published_at IS NULL
+AND next_attempt_at <= NOW()
+ORDER BY created_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox_events
+    SET published_at = NOW(),
+        last_error = NULL
+    WHERE id = $1;
+
+-- name: RecordOutboxEventFailure :exec
+UPDATE outbox_events
+    SET attempts = attempts + 1,
+        next_attempt_at = $2,
+        last_error = $3
+    WHERE id = $1;
+
+-- name: DeletePublishedOutboxEventsBefore :execrows
+DELETE FROM outbox_events
+WHERE published_at < $1;
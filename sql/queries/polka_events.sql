@@ -0,0 +1,12 @@
+-- name: RecordPolkaEvent :execrows
+INSERT INTO polka_events (id, created_at, event)
+VALUES (
+    $1,
+    NOW(),
+    $2
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeletePolkaEventsBefore :execrows
+DELETE FROM polka_events
+WHERE created_at < $1;
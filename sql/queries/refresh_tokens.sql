@@ -14,11 +14,73 @@ RETURNING *;
 SELECT users.* FROM users
     JOIN refresh_tokens ON users.id = refresh_tokens.user_id
         WHERE refresh_tokens.token = $1
+        AND refresh_tokens.client_id IS NULL
         AND revoked_at IS NULL
         AND expires_at > NOW();
 
+-- name: ListRefreshTokensForUser :many
+SELECT created_at, expires_at, revoked_at, client_id FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
     SET revoked_at = NOW(),
         updated_at = NOW() 
-    WHERE token = $1;
\ No newline at end of file
+    WHERE token = $1;
+
+-- name: RevokeRefreshTokenByHash :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE user_id = sqlc.arg(user_id)
+    AND encode(sha256(convert_to(token, 'UTF8')), 'hex') = sqlc.arg(token_hash)::text;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE user_id = $1
+    AND revoked_at IS NULL;
+
+-- name: RevokeOAuthRefreshTokensForUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE user_id = $1
+    AND client_id = $2
+    AND revoked_at IS NULL;
+
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    NULL,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetOAuthRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token = $1
+AND client_id = $2
+AND revoked_at IS NULL
+AND expires_at > NOW();
+
+-- name: RevokeOAuthRefreshToken :execrows
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+        updated_at = NOW()
+    WHERE token = $1
+    AND client_id = $2
+    AND revoked_at IS NULL;
+
+-- name: DeleteStaleRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < sqlc.arg(before)
+OR revoked_at < sqlc.arg(before);
@@ -0,0 +1,23 @@
+-- name: TryAdvisoryLock :one
+SELECT pg_try_advisory_lock(sqlc.arg(key)::bigint);
+
+-- name: AdvisoryUnlock :one
+SELECT pg_advisory_unlock(sqlc.arg(key)::bigint);
+
+-- name: AdvisoryXactLock :exec
+SELECT pg_advisory_xact_lock(sqlc.arg(key)::bigint);
+
+-- name: GetScheduledTaskLastRun :one
+SELECT last_run_at FROM scheduled_tasks
+WHERE name = $1;
+
+-- name: RecordScheduledTaskRun :exec
+INSERT INTO scheduled_tasks (name, last_run_at, last_error)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (name) DO UPDATE
+    SET last_run_at = EXCLUDED.last_run_at,
+        last_error = EXCLUDED.last_error;
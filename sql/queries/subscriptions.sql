@@ -0,0 +1,41 @@
+-- name: CreateSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_start, current_period_end, cancel_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE id = $1;
+
+-- name: GetLatestSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: UpdateSubscription :one
+UPDATE subscriptions
+    SET plan = $2,
+        status = $3,
+        current_period_start = $4,
+        current_period_end = $5,
+        cancel_at = $6,
+        updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: ListLapsedSubscriptions :many
+SELECT * FROM subscriptions
+WHERE status IN ('active', 'past_due')
+AND current_period_end <= $1;
+
@@ -9,12 +9,16 @@ VALUES (
 )
 RETURNING *;
 
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
+
 -- name: DeleteUsers :exec
 DELETE FROM users;
 
 -- name: GetUserByEmail :one
 SELECT * FROM users
-WHERE email = $1
+WHERE lower(email) = lower($1)
 LIMIT 1;
 
 -- name: GetUserById :one
@@ -26,11 +30,60 @@ LIMIT 1;
 UPDATE users
     SET email = $1,
         hashed_password = $2,
+        email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END,
         updated_at = NOW()
     WHERE id = $3
 RETURNING *;
 
--- name: UpgradeUser :exec
+-- name: UpdateUserPassword :exec
+UPDATE users
+    SET hashed_password = $2,
+        updated_at = NOW()
+    WHERE id = $1;
+
+-- name: MarkEmailVerified :execrows
+UPDATE users
+    SET email_verified_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1
+    AND email = $2;
+
+-- name: DeactivateUser :one
+UPDATE users
+    SET deactivated_at = COALESCE(deactivated_at, NOW()),
+        updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: ReactivateUser :exec
 UPDATE users
-    SET is_chirpy_red = true
-    WHERE id = $1;
\ No newline at end of file
+    SET deactivated_at = NULL,
+        updated_at = NOW()
+    WHERE id = $1;
+
+-- name: IsUserActive :one
+SELECT deactivated_at IS NULL AS active FROM users
+WHERE id = $1;
+
+-- name: PurgeDeactivatedUsers :many
+DELETE FROM users
+WHERE deactivated_at < $1
+RETURNING id;
+
+-- name: SetUserChirpyRed :exec
+UPDATE users
+    SET is_chirpy_red = $2,
+        updated_at = NOW()
+    WHERE id = $1;
+
+-- name: CountPasswordHashes :one
+SELECT
+    COUNT(*) FILTER (WHERE hashed_password LIKE '$argon2id$%') AS total,
+    COUNT(*) FILTER (
+        WHERE hashed_password LIKE '$argon2id$%'
+        AND (
+            hashed_password NOT LIKE sqlc.arg(current_prefix)::text || '%'
+            OR length(hashed_password) <> sqlc.arg(current_length)::int
+        )
+    ) AS legacy
+FROM users;
@@ -0,0 +1,64 @@
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    'pending',
+    0,
+    NOW()
+)
+ON CONFLICT (endpoint_id, event_id) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+    SET locked_until = sqlc.arg(locked_until)
+    FROM webhook_endpoints
+    WHERE webhook_endpoints.id = webhook_deliveries.endpoint_id
+    AND webhook_deliveries.id IN (
+        SELECT webhook_deliveries.id FROM webhook_deliveries
+        JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id
+        WHERE webhook_deliveries.status = 'pending'
+        AND webhook_deliveries.next_attempt_at <= NOW()
+        AND (webhook_deliveries.locked_until IS NULL OR webhook_deliveries.locked_until < NOW())
+        AND webhook_endpoints.disabled_at IS NULL
+        ORDER BY webhook_deliveries.next_attempt_at
+        LIMIT sqlc.arg(max_deliveries)
+        FOR UPDATE OF webhook_deliveries SKIP LOCKED
+    )
+RETURNING webhook_deliveries.*, webhook_endpoints.url, webhook_endpoints.secret;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1
+AND endpoint_id = $2;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: RecordWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+    SET status = $2,
+        attempts = attempts + 1,
+        next_attempt_at = $3,
+        locked_until = NULL,
+        last_attempt_at = NOW(),
+        response_status = $4,
+        response_body = $5,
+        error = $6,
+        delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE delivered_at END,
+        updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: DeleteWebhookDeliveriesBefore :execrows
+DELETE FROM webhook_deliveries
+WHERE created_at < $1
+AND status <> 'pending';
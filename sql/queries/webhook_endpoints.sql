@@ -0,0 +1,65 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, event_types, consecutive_failures, disabled_at, disabled_reason)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    0,
+    NULL,
+    NULL
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1
+AND user_id = $2;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ListWebhookEndpointsForEvent :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = sqlc.arg(user_id)
+AND sqlc.arg(event_type)::text = ANY(event_types)
+AND disabled_at IS NULL;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1
+AND user_id = $2;
+
+-- name: EnableWebhookEndpoint :execrows
+UPDATE webhook_endpoints
+    SET consecutive_failures = 0,
+        disabled_at = NULL,
+        disabled_reason = NULL,
+        updated_at = NOW()
+    WHERE id = $1
+    AND user_id = $2;
+
+-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints
+    SET consecutive_failures = 0
+    WHERE id = $1;
+
+-- name: RecordWebhookEndpointFailure :one
+UPDATE webhook_endpoints
+    SET consecutive_failures = consecutive_failures + 1
+    WHERE id = $1
+RETURNING consecutive_failures;
+
+-- name: DisableWebhookEndpoint :one
+UPDATE webhook_endpoints
+    SET disabled_at = NOW(),
+        disabled_reason = $2,
+        updated_at = NOW()
+    WHERE id = $1
+    AND disabled_at IS NULL
+RETURNING *;
@@ -0,0 +1,41 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, created_at, updated_at, source, event_id, event_type, headers, payload, status, error, attempts, processed_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    'received',
+    NULL,
+    0,
+    NULL
+)
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT id, created_at, updated_at, source, event_id, event_type, status, error, attempts, processed_at FROM webhook_events
+WHERE sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_events);
+
+-- name: SetWebhookEventOutcome :one
+UPDATE webhook_events
+    SET status = $2,
+        error = $3,
+        attempts = attempts + 1,
+        processed_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: DeleteWebhookEventsBefore :execrows
+DELETE FROM webhook_events
+WHERE created_at < $1;
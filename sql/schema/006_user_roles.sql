@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE user_roles(
+    user_id UUID NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, role),
+    CONSTRAINT fk_user
+      FOREIGN KEY(user_id)
+        REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_roles;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens(
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    CONSTRAINT fk_user
+      FOREIGN KEY(user_id)
+        REFERENCES users(id)
+    ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX magic_link_tokens_user_id_created_at_idx ON magic_link_tokens (user_id, created_at);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE login_events(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID,
+    CONSTRAINT fk_user
+      FOREIGN KEY(user_id)
+        REFERENCES users(id)
+    ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    method TEXT NOT NULL,
+    success BOOLEAN NOT NULL,
+    failure_reason TEXT,
+    ip_address TEXT NOT NULL,
+    network TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    new_device BOOLEAN NOT NULL,
+    new_network BOOLEAN NOT NULL,
+    refresh_token TEXT,
+    CONSTRAINT fk_refresh_token
+      FOREIGN KEY(refresh_token)
+        REFERENCES refresh_tokens(token)
+    ON DELETE SET NULL,
+    revoke_token_hash TEXT UNIQUE
+);
+
+CREATE INDEX login_events_user_id_created_at_idx ON login_events (user_id, created_at);
+
+-- +goose Down
+DROP TABLE login_events;
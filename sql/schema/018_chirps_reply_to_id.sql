@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN reply_to_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_reply_to_id_idx ON chirps (reply_to_id);
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN reply_to_id;
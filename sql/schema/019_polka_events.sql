@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE polka_events(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    event TEXT NOT NULL
+);
+
+CREATE INDEX polka_events_created_at_idx ON polka_events (created_at);
+
+-- +goose Down
+DROP TABLE polka_events;
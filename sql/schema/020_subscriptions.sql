@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE subscriptions(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    CONSTRAINT fk_user
+      FOREIGN KEY(user_id)
+        REFERENCES users(id)
+    ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    cancel_at TIMESTAMP
+);
+
+CREATE INDEX subscriptions_user_id_created_at_idx ON subscriptions (user_id, created_at);
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions (current_period_end)
+WHERE status IN ('active', 'past_due');
+
+-- Users upgraded before subscriptions were tracked get a month, which
+-- Polka's next renewal extends.
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_start, current_period_end, cancel_at)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'chirpy_red', 'active', NOW(), NOW() + INTERVAL '1 month', NULL
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
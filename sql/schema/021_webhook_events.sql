@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE webhook_events(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    source TEXT NOT NULL,
+    event_id TEXT,
+    event_type TEXT NOT NULL,
+    headers JSONB NOT NULL,
+    payload BYTEA NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX webhook_events_created_at_idx ON webhook_events (created_at);
+CREATE INDEX webhook_events_status_created_at_idx ON webhook_events (status, created_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
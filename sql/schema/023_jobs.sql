@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE jobs(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    kind TEXT NOT NULL,
+    args JSONB NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    unique_key TEXT,
+    last_error TEXT,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX jobs_run_at_idx ON jobs (run_at)
+WHERE status = 'queued';
+CREATE INDEX jobs_status_created_at_idx ON jobs (status, created_at);
+-- Only one job with a given key can be waiting or running at a time.
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (unique_key)
+WHERE status IN ('queued', 'running');
+
+-- +goose Down
+DROP TABLE jobs;
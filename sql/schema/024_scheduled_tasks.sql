@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE scheduled_tasks(
+    name TEXT PRIMARY KEY,
+    last_run_at TIMESTAMP NOT NULL,
+    last_error TEXT
+);
+
+-- +goose Down
+DROP TABLE scheduled_tasks;
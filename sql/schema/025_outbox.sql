@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE outbox_events(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    event_type TEXT NOT NULL,
+    -- Not a foreign key: events outlive the users they are about, such as
+    -- the user.deleted event of a deleted account.
+    user_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX outbox_events_next_attempt_at_idx ON outbox_events (next_attempt_at)
+WHERE published_at IS NULL;
+CREATE INDEX outbox_events_published_at_idx ON outbox_events (published_at);
+
+-- Lets webhook deliveries be queued more than once for an event, as the
+-- outbox may publish it again, while only being sent once.
+CREATE UNIQUE INDEX webhook_deliveries_endpoint_id_event_id_idx ON webhook_deliveries (endpoint_id, event_id);
+
+-- +goose Down
+DROP INDEX webhook_deliveries_endpoint_id_event_id_idx;
+DROP TABLE outbox_events;
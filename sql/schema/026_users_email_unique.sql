@@ -0,0 +1,35 @@
+-- +goose Up
+-- Emails are compared case-insensitively, so addresses differing only in
+-- case would belong to one account. This refuses to run while such
+-- duplicates exist, rather than guess which account to keep. List them with
+--
+--     SELECT lower(email), array_agg(id ORDER BY created_at)
+--     FROM users GROUP BY lower(email) HAVING count(*) > 1;
+--
+-- and merge, delete or re-address the extra accounts before migrating.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(email, ', ' ORDER BY email) INTO duplicates
+    FROM (
+        SELECT lower(email) AS email
+        FROM users
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) d;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'users share an email address differing only in case: %', duplicates
+            USING HINT = 'Resolve the duplicate accounts, then run the migration again.';
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+DROP INDEX users_email_lower_idx;
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email));
+
+-- +goose Down
+DROP INDEX users_email_lower_idx;
+CREATE INDEX users_email_lower_idx ON users (lower(email));
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Records which chirp each archive chirp was imported as, so importing an
+-- archive again skips the chirps already imported. The record is kept when
+-- the chirp is deleted, so deleted chirps aren't brought back either.
+CREATE TABLE imported_chirps(
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    PRIMARY KEY (user_id, source_id)
+);
+
+-- +goose Down
+DROP TABLE imported_chirps;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- OAuth logins grant an app access rather than starting a session of
+-- their own, so signing one out revokes the app's tokens for the user.
+ALTER TABLE login_events
+ADD COLUMN oauth_client_id TEXT REFERENCES oauth_clients(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE login_events
+DROP COLUMN oauth_client_id;
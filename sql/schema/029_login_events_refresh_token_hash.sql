@@ -0,0 +1,25 @@
+-- +goose Up
+-- Login events only keep a hash of their session's refresh token, so the
+-- history can't be used to take over sessions that are still live.
+ALTER TABLE login_events
+ADD COLUMN refresh_token_hash TEXT;
+
+UPDATE login_events
+    SET refresh_token_hash = encode(sha256(convert_to(refresh_token, 'UTF8')), 'hex')
+    WHERE refresh_token IS NOT NULL;
+
+ALTER TABLE login_events
+DROP COLUMN refresh_token;
+
+-- +goose Down
+ALTER TABLE login_events
+ADD COLUMN refresh_token TEXT REFERENCES refresh_tokens(token) ON DELETE SET NULL;
+
+UPDATE login_events
+    SET refresh_token = refresh_tokens.token
+    FROM refresh_tokens
+    WHERE refresh_tokens.user_id = login_events.user_id
+    AND encode(sha256(convert_to(refresh_tokens.token, 'UTF8')), 'hex') = login_events.refresh_token_hash;
+
+ALTER TABLE login_events
+DROP COLUMN refresh_token_hash;
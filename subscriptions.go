@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/billing"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+)
+
+func subscriptionFromDB(dbSub database.Subscription) billing.Subscription {
+	return billing.Subscription{
+		Plan:        dbSub.Plan,
+		Status:      billing.Status(dbSub.Status),
+		PeriodStart: dbSub.CurrentPeriodStart,
+		PeriodEnd:   dbSub.CurrentPeriodEnd,
+		CancelAt:    dbSub.CancelAt.Time,
+	}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// applySubscriptionEvent updates a user's subscription for a Polka event,
+// and their Chirpy Red status with it. A new subscription is announced with
+// a user.upgraded event. q must be bound to a transaction, which holds the
+// lock on the user's subscriptions until it ends.
+func applySubscriptionEvent(ctx context.Context, q *database.Queries, userID uuid.UUID, event billing.Event) error {
+	// Events for the same user are applied one at a time, or each would
+	// compute its change from the subscription before the other's. A row
+	// lock wouldn't cover users without a subscription yet.
+	if err := lockUser(ctx, q, "subscriptions", userID); err != nil {
+		return err
+	}
+	var current *billing.Subscription
+	dbSub, err := q.GetLatestSubscription(ctx, userID)
+	if err == nil {
+		sub := subscriptionFromDB(dbSub)
+		current = &sub
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	next, started, err := billing.Apply(current, event)
+	if err != nil {
+		return err
+	}
+	if started {
+		_, err = q.CreateSubscription(ctx, database.CreateSubscriptionParams{
+			UserID:             userID,
+			Plan:               next.Plan,
+			Status:             string(next.Status),
+			CurrentPeriodStart: next.PeriodStart,
+			CurrentPeriodEnd:   next.PeriodEnd,
+			CancelAt:           nullTime(next.CancelAt),
+		})
+		if err == nil {
+			_, err = outbox.Write(ctx, q, eventUserUpgraded, userID, userUpgradedEvent{
+				UserID:           userID,
+				Plan:             next.Plan,
+				CurrentPeriodEnd: next.PeriodEnd,
+			})
+		}
+	} else {
+		_, err = updateSubscription(ctx, q, dbSub.ID, next)
+	}
+	if err != nil {
+		return err
+	}
+	return syncChirpyRed(ctx, q, userID, next)
+}
+
+func updateSubscription(ctx context.Context, q *database.Queries, id uuid.UUID, sub billing.Subscription) (database.Subscription, error) {
+	return q.UpdateSubscription(ctx, database.UpdateSubscriptionParams{
+		ID:                 id,
+		Plan:               sub.Plan,
+		Status:             string(sub.Status),
+		CurrentPeriodStart: sub.PeriodStart,
+		CurrentPeriodEnd:   sub.PeriodEnd,
+		CancelAt:           nullTime(sub.CancelAt),
+	})
+}
+
+// syncChirpyRed sets whether a user has Chirpy Red from their latest
+// subscription. is_chirpy_red is only ever written here, so it can't drift
+// from the subscriptions.
+func syncChirpyRed(ctx context.Context, q *database.Queries, userID uuid.UUID, sub billing.Subscription) error {
+	return q.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{
+		ID:          userID,
+		IsChirpyRed: sub.Entitled(time.Now().UTC()),
+	})
+}
+
+// expireSubscriptions ends the subscriptions whose paid period is over
+// without Polka having renewed them.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) error {
+	now := time.Now().UTC()
+	lapsed, err := cfg.db.ListLapsedSubscriptions(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, dbSub := range lapsed {
+		var sub billing.Subscription
+		changed := false
+		err := cfg.withTx(ctx, func(q *database.Queries) error {
+			// Read the subscription again under the lock, in case Polka
+			// renewed it since it was listed.
+			if err := lockUser(ctx, q, "subscriptions", dbSub.UserID); err != nil {
+				return err
+			}
+			dbSub, err := q.GetSubscription(ctx, dbSub.ID)
+			if err != nil {
+				return err
+			}
+			sub, changed = billing.Expire(subscriptionFromDB(dbSub), now)
+			if !changed {
+				return nil
+			}
+			if _, err := updateSubscription(ctx, q, dbSub.ID, sub); err != nil {
+				return err
+			}
+			return syncChirpyRed(ctx, q, dbSub.UserID, sub)
+		})
+		if err != nil {
+			return err
+		}
+		if changed {
+			slog.Info("Expired subscription", "subscription_id", dbSub.ID, "user_id", dbSub.UserID, "status", sub.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/billing"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	cfg.polkaWebhookSecret = "test-webhook-secret"
+
+	credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+
+	send := func(event string) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{
+			"id":    uuid.NewString(),
+			"event": event,
+			"data":  map[string]string{"user_id": user.Id.String()},
+		})
+		if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), body), body); code != http.StatusNoContent {
+			t.Fatalf("%s webhook status = %d, want %d", event, code, http.StatusNoContent)
+		}
+	}
+	check := func(step string, wantStatus billing.Status, wantRed bool) {
+		t.Helper()
+		sub, err := cfg.db.GetLatestSubscription(context.Background(), user.Id)
+		if err != nil {
+			t.Fatalf("%s: Couldn't get subscription: %v", step, err)
+		}
+		dbUser, err := cfg.db.GetUserById(context.Background(), user.Id)
+		if err != nil {
+			t.Fatalf("%s: Couldn't get user: %v", step, err)
+		}
+		if billing.Status(sub.Status) != wantStatus || dbUser.IsChirpyRed != wantRed {
+			t.Errorf("%s: status = %s, is_chirpy_red = %v, want %s, %v", step, sub.Status, dbUser.IsChirpyRed, wantStatus, wantRed)
+		}
+	}
+
+	send(billing.EventUpgraded)
+	check("upgraded", billing.StatusActive, true)
+	send(billing.EventPaymentFailed)
+	check("payment failed", billing.StatusPastDue, true)
+	send(billing.EventRenewed)
+	check("renewed", billing.StatusActive, true)
+	send(billing.EventDowngraded)
+	check("downgraded", billing.StatusActive, true)
+
+	// Let the period run out.
+	sub, _ := cfg.db.GetLatestSubscription(context.Background(), user.Id)
+	lapsed := subscriptionFromDB(sub)
+	lapsed.PeriodEnd = time.Now().UTC().Add(-time.Minute)
+	if _, err := updateSubscription(context.Background(), cfg.db, sub.ID, lapsed); err != nil {
+		t.Fatalf("Couldn't update subscription: %v", err)
+	}
+	if err := cfg.expireSubscriptions(context.Background()); err != nil {
+		t.Fatalf("expireSubscriptions() error = %v", err)
+	}
+	check("expired", billing.StatusCanceled, false)
+
+	send(billing.EventUpgraded)
+	check("upgraded again", billing.StatusActive, true)
+	send(billing.EventRefunded)
+	check("refunded", billing.StatusRefunded, false)
+	// Downgrading an ended subscription is acknowledged and changes nothing.
+	send(billing.EventDowngraded)
+	check("downgraded after refund", billing.StatusRefunded, false)
+}
+
+func TestConcurrentSubscriptionEvents(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	user, _ := createTestUser(t, chirpy.URL)
+
+	// Without a lock, each upgrade would see no subscription and start one.
+	const upgrades = 5
+	var wg sync.WaitGroup
+	for range upgrades {
+		wg.Go(func() {
+			ctx := context.Background()
+			err := cfg.withTx(ctx, func(q *database.Queries) error {
+				return applySubscriptionEvent(ctx, q, user.Id, billing.Event{
+					Type: billing.EventUpgraded,
+					At:   time.Now().UTC(),
+				})
+			})
+			if err != nil {
+				t.Errorf("applySubscriptionEvent() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	var count int
+	if err := cfg.sqlDB.QueryRow("SELECT count(*) FROM subscriptions WHERE user_id = $1", user.Id).Scan(&count); err != nil {
+		t.Fatalf("Couldn't count subscriptions: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("user has %d subscriptions, want 1", count)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/jobs"
+	"github.com/gyulaieric/chirpy/internal/lockout"
+	"github.com/gyulaieric/chirpy/internal/mailer"
+	"github.com/gyulaieric/chirpy/internal/outbox"
+	"github.com/gyulaieric/chirpy/internal/validation"
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+// openTestDB connects to the database in CHIRPY_TEST_DB_URL, skipping the
+// test if it isn't set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		if os.Getenv("CHIRPY_REQUIRE_TEST_DB") != "" {
+			t.Fatal("CHIRPY_TEST_DB_URL is not set, but CHIRPY_REQUIRE_TEST_DB is")
+		}
+		t.Skip("CHIRPY_TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Couldn't connect to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestServer starts Chirpy against the database in CHIRPY_TEST_DB_URL,
+// which must already be migrated. Tests using it are skipped without one.
+// The outbox relay isn't run, so tests relay events when they need them.
+func newTestServer(t *testing.T) (*httptest.Server, *apiConfig) {
+	t.Helper()
+	db := openTestDB(t)
+
+	queries := database.New(db)
+	cfg := &apiConfig{
+		db:             queries,
+		sqlDB:          db,
+		jwtSecret:      "test-secret",
+		platform:       "test",
+		polkaKey:       "test-polka-key",
+		mailer:         mailer.NewLogMailer("", "chirpy@example.com"),
+		passwordPolicy: validation.DefaultPasswordPolicy(),
+		accountLockout: lockout.DefaultAccountPolicy(),
+		ipLockout:      lockout.DefaultIPPolicy(),
+
+		accountDeletionGracePeriod: defaultAccountDeletionGracePeriod,
+		polkaWebhookTolerance:      webhook.DefaultTolerance,
+		webhookClient:              webhook.NewClient(webhookDeliveryTimeout, true),
+		jobs:                       jobs.New(queries),
+		relay:                      outbox.NewRelay(db),
+	}
+	cfg.registerJobs()
+	cfg.registerEventSubscribers()
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	go func() {
+		cfg.jobs.Run(ctx, 2)
+		close(drained)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-drained
+	})
+	server := httptest.NewServer(cfg.routes(http.Dir(".")))
+	t.Cleanup(server.Close)
+	cfg.baseURL = server.URL
+	return server, cfg
+}
+
+func doJSON(t *testing.T, method, url, token string, body any, out any) int {
+	t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			t.Fatalf("Couldn't encode request: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &reqBody)
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+// createTestUser signs up a user with a unique email and logs them in,
+// returning them and their credentials.
+func createTestUser(t *testing.T, chirpyURL string) (User, map[string]string) {
+	t.Helper()
+	credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+	if code := doJSON(t, http.MethodPost, chirpyURL+"/api/users", "", credentials, nil); code != http.StatusCreated {
+		t.Fatalf("sign up status = %d, want %d", code, http.StatusCreated)
+	}
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpyURL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+	return user, credentials
+}
+
+// serveAdmin calls an admin handler directly, skipping the admin check.
+func serveAdmin(t *testing.T, h http.Handler, method, target string, pathValues map[string]string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for name, value := range pathValues {
+		req.SetPathValue(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil && rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("Couldn't decode response: %v", err)
+		}
+	}
+	return rec.Code
+}
+
+// chanMailer hands sent messages to the test.
+type chanMailer chan mailer.Message
+
+func (m chanMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// receiveLink waits for an email and returns the link in it.
+func receiveLink(t *testing.T, mail chanMailer) *url.URL {
+	t.Helper()
+	select {
+	case msg := <-mail:
+		match := linkPattern.FindString(msg.Body)
+		if match == "" {
+			t.Fatalf("no link in email %q", msg.Body)
+		}
+		link, err := url.Parse(match)
+		if err != nil {
+			t.Fatalf("Couldn't parse link %q: %v", match, err)
+		}
+		return link
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no email sent")
+		return nil
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the Postgres error code for a duplicate key.
+const uniqueViolation = "23505"
+
+// withTx runs fn in a transaction, committing it if fn succeeds and rolling
+// it back otherwise. fn must make its queries with the q it's given.
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(cfg.db.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a row that
+// would duplicate a unique key.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// lockUser holds a lock on one of a user's resources, such as their
+// subscriptions, until the transaction q belongs to ends. Like the
+// scheduler's, the lock keys are derived from a prefix so they don't collide
+// with other advisory locks.
+func lockUser(ctx context.Context, q *database.Queries, resource string, userID uuid.UUID) error {
+	h := fnv.New64a()
+	h.Write([]byte("chirpy/" + resource + "/" + userID.String()))
+	return q.AdvisoryXactLock(ctx, int64(h.Sum64()))
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/database"
+	"github.com/gyulaieric/chirpy/internal/logging"
+)
+
+const (
+	webhookSourcePolka = "polka"
+
+	// webhookEventReceived is a delivery that hasn't finished processing,
+	// usually because the server stopped while processing it.
+	webhookEventReceived  = "received"
+	webhookEventProcessed = "processed"
+	webhookEventIgnored   = "ignored"
+	// webhookEventDuplicate is a delivery of an event that had already been
+	// processed.
+	webhookEventDuplicate = "duplicate"
+	webhookEventFailed    = "failed"
+
+	webhookEventRetention  = 30 * 24 * time.Hour
+	maxWebhookEventsListed = 100
+)
+
+// redactedWebhookHeaders aren't stored, since they can carry credentials.
+var redactedWebhookHeaders = []string{"Authorization", "Cookie"}
+
+// webhookOutcome is the result of processing a webhook delivery. Failed
+// deliveries carry the error response to send.
+type webhookOutcome struct {
+	status     string
+	httpStatus int
+	message    string
+	err        error
+}
+
+func webhookFailure(httpStatus int, message string, err error) webhookOutcome {
+	return webhookOutcome{status: webhookEventFailed, httpStatus: httpStatus, message: message, err: err}
+}
+
+func (o webhookOutcome) errorText() sql.NullString {
+	text := o.message
+	if o.err != nil {
+		if text != "" {
+			text += ": "
+		}
+		text += o.err.Error()
+	}
+	return sql.NullString{String: text, Valid: text != ""}
+}
+
+type WebhookEvent struct {
+	Id          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Source      string          `json:"source"`
+	EventID     string          `json:"event_id,omitempty"`
+	EventType   string          `json:"event_type"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+	Headers     json.RawMessage `json:"headers,omitempty"`
+	Payload     string          `json:"payload,omitempty"`
+}
+
+func webhookEventFromDB(event database.WebhookEvent) WebhookEvent {
+	e := webhookEventSummaryFromDB(database.ListWebhookEventsRow{
+		ID:          event.ID,
+		CreatedAt:   event.CreatedAt,
+		UpdatedAt:   event.UpdatedAt,
+		Source:      event.Source,
+		EventID:     event.EventID,
+		EventType:   event.EventType,
+		Status:      event.Status,
+		Error:       event.Error,
+		Attempts:    event.Attempts,
+		ProcessedAt: event.ProcessedAt,
+	})
+	e.Headers = event.Headers
+	e.Payload = string(event.Payload)
+	return e
+}
+
+func webhookEventSummaryFromDB(event database.ListWebhookEventsRow) WebhookEvent {
+	e := WebhookEvent{
+		Id:        event.ID,
+		CreatedAt: event.CreatedAt,
+		UpdatedAt: event.UpdatedAt,
+		Source:    event.Source,
+		EventID:   event.EventID.String,
+		EventType: event.EventType,
+		Status:    event.Status,
+		Error:     event.Error.String,
+		Attempts:  event.Attempts,
+	}
+	if event.ProcessedAt.Valid {
+		e.ProcessedAt = &event.ProcessedAt.Time
+	}
+	return e
+}
+
+// recordWebhookEvent stores a delivery before it is processed, so it can be
+// inspected and replayed if processing fails.
+func (cfg *apiConfig) recordWebhookEvent(ctx context.Context, source string, header http.Header, body []byte) (database.WebhookEvent, error) {
+	header = header.Clone()
+	for _, name := range redactedWebhookHeaders {
+		header.Del(name)
+	}
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return database.WebhookEvent{}, err
+	}
+	// Unreadable payloads are still recorded; processing reports them.
+	var envelope struct {
+		ID    string `json:"id"`
+		Event string `json:"event"`
+	}
+	json.Unmarshal(body, &envelope)
+
+	return cfg.db.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{
+		Source:    source,
+		EventID:   sql.NullString{String: envelope.ID, Valid: envelope.ID != ""},
+		EventType: envelope.Event,
+		Headers:   headers,
+		Payload:   body,
+	})
+}
+
+func (cfg *apiConfig) setWebhookEventOutcome(ctx context.Context, id uuid.UUID, outcome webhookOutcome) (database.WebhookEvent, error) {
+	event, err := cfg.db.SetWebhookEventOutcome(context.WithoutCancel(ctx), database.SetWebhookEventOutcomeParams{
+		ID:     id,
+		Status: outcome.status,
+		Error:  outcome.errorText(),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't record outcome of webhook event", "event_id", id, "error", err)
+	}
+	return event, err
+}
+
+// webhookProcessor returns the function that processes deliveries from
+// source, given their logged ID, payload and when they were received, or nil
+// if there is none.
+func (cfg *apiConfig) webhookProcessor(source string) func(context.Context, uuid.UUID, []byte, time.Time) webhookOutcome {
+	switch source {
+	case webhookSourcePolka:
+		return cfg.processPolkaEvent
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerAdminListWebhookEvents() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		dbEvents, err := cfg.db.ListWebhookEvents(r.Context(), database.ListWebhookEventsParams{
+			Status:    sql.NullString{String: status, Valid: status != ""},
+			MaxEvents: maxWebhookEventsListed,
+		})
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't list webhook events", err)
+			return
+		}
+
+		events := []WebhookEvent{}
+		for _, dbEvent := range dbEvents {
+			events = append(events, webhookEventSummaryFromDB(dbEvent))
+		}
+		respondWithJSON(w, http.StatusOK, events)
+	})
+}
+
+func (cfg *apiConfig) handlerAdminGetWebhookEvent() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := uuid.Parse(r.PathValue("eventID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid webhook event ID", err)
+			return
+		}
+
+		event, err := cfg.db.GetWebhookEvent(r.Context(), eventID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Webhook event not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get webhook event", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, webhookEventFromDB(event))
+	})
+}
+
+// handlerAdminReplayWebhookEvent processes a stored delivery again, such as
+// one that failed before the problem was fixed. Its signature isn't checked
+// again: it was checked on delivery, and its timestamp has likely expired
+// since. Events that have already been processed aren't applied twice, even
+// those without an event ID, which are recognised by their delivery.
+func (cfg *apiConfig) handlerAdminReplayWebhookEvent() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := uuid.Parse(r.PathValue("eventID"))
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid webhook event ID", err)
+			return
+		}
+
+		event, err := cfg.db.GetWebhookEvent(r.Context(), eventID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, http.StatusNotFound, "Webhook event not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't get webhook event", err)
+			return
+		}
+		if event.Status != webhookEventFailed && event.Status != webhookEventReceived {
+			respondWithJSON(w, http.StatusOK, webhookEventFromDB(event))
+			return
+		}
+		process := cfg.webhookProcessor(event.Source)
+		if process == nil {
+			respondWithError(w, r, http.StatusUnprocessableEntity, "Can't replay "+event.Source+" webhooks", nil)
+			return
+		}
+
+		outcome := process(r.Context(), event.ID, event.Payload, event.CreatedAt)
+		event, err = cfg.setWebhookEventOutcome(r.Context(), event.ID, outcome)
+		if err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, "Couldn't record outcome", err)
+			return
+		}
+		logging.FromContext(r.Context()).Info("Replayed webhook event", "event_id", event.ID, "status", event.Status)
+		respondWithJSON(w, http.StatusOK, webhookEventFromDB(event))
+	})
+}
+
+// purgeWebhookEvents deletes logged deliveries past their retention period.
+func (cfg *apiConfig) purgeWebhookEvents(ctx context.Context) error {
+	deleted, err := cfg.db.DeleteWebhookEventsBefore(ctx, time.Now().UTC().Add(-webhookEventRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Deleted logged webhook events", "count", deleted)
+	}
+	return nil
+}
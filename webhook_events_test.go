@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gyulaieric/chirpy/internal/webhook"
+)
+
+func TestWebhookEventLog(t *testing.T) {
+	chirpy, cfg := newTestServer(t)
+	cfg.polkaWebhookSecret = "test-webhook-secret"
+
+	credentials := map[string]string{"email": uuid.NewString() + "@example.com", "password": "correct horse battery staple"}
+	doJSON(t, http.MethodPost, chirpy.URL+"/api/users", "", credentials, nil)
+	var user User
+	if code := doJSON(t, http.MethodPost, chirpy.URL+"/api/login", "", credentials, &user); code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", code, http.StatusOK)
+	}
+	event := func(id string, userID uuid.UUID) []byte {
+		body, _ := json.Marshal(map[string]any{
+			"id":    id,
+			"event": "user.upgraded",
+			"data":  map[string]string{"user_id": userID.String()},
+		})
+		return body
+	}
+
+	// A delivery for a user that doesn't exist fails, and is logged.
+	failedID := uuid.NewString()
+	body := event(failedID, uuid.New())
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), body), body); code != http.StatusNotFound {
+		t.Fatalf("webhook status = %d, want %d", code, http.StatusNotFound)
+	}
+	var events []WebhookEvent
+	serveAdmin(t, cfg.handlerAdminListWebhookEvents(), http.MethodGet, "/admin/webhook-events?status=failed", nil, &events)
+	var failed *WebhookEvent
+	for i := range events {
+		if events[i].EventID == failedID {
+			failed = &events[i]
+		}
+	}
+	if failed == nil {
+		t.Fatalf("failed delivery %s isn't listed", failedID)
+	}
+	if !strings.Contains(failed.Error, "User not found") {
+		t.Errorf("error = %q, want it to say why", failed.Error)
+	}
+
+	var logged WebhookEvent
+	serveAdmin(t, cfg.handlerAdminGetWebhookEvent(), http.MethodGet, "/", map[string]string{"eventID": failed.Id.String()}, &logged)
+	if logged.Payload != string(body) || !strings.Contains(string(logged.Headers), "Polka-Signature") {
+		t.Errorf("event = %+v, want the delivery's payload and headers", logged)
+	}
+	var replayed WebhookEvent
+	serveAdmin(t, cfg.handlerAdminReplayWebhookEvent(), http.MethodPost, "/", map[string]string{"eventID": failed.Id.String()}, &replayed)
+	if replayed.Status != webhookEventFailed || replayed.Attempts != 2 {
+		t.Errorf("replayed event = %s after %d attempts, want failed after 2", replayed.Status, replayed.Attempts)
+	}
+
+	// A delivery that was logged but never processed, as if the server
+	// stopped, is applied once however often it is replayed.
+	eventID := uuid.NewString()
+	body = event(eventID, user.Id)
+	stored, err := cfg.recordWebhookEvent(context.Background(), webhookSourcePolka, http.Header{}, body)
+	if err != nil {
+		t.Fatalf("Couldn't record webhook event: %v", err)
+	}
+	// It was received a day ago, which the subscription should start from.
+	receivedAt := stored.CreatedAt.Add(-24 * time.Hour)
+	if _, err := cfg.sqlDB.Exec("UPDATE webhook_events SET created_at = $2 WHERE id = $1", stored.ID, receivedAt); err != nil {
+		t.Fatalf("Couldn't backdate webhook event: %v", err)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		serveAdmin(t, cfg.handlerAdminReplayWebhookEvent(), http.MethodPost, "/", map[string]string{"eventID": stored.ID.String()}, &replayed)
+		if replayed.Status != webhookEventProcessed || replayed.Attempts != 1 {
+			t.Errorf("replay %d: event = %s after %d attempts, want processed after 1", attempt, replayed.Status, replayed.Attempts)
+		}
+	}
+	dbUser, err := cfg.db.GetUserById(context.Background(), user.Id)
+	if err != nil || !dbUser.IsChirpyRed {
+		t.Errorf("replayed upgrade wasn't applied")
+	}
+	sub, err := cfg.db.GetLatestSubscription(context.Background(), user.Id)
+	if err != nil || !sub.CurrentPeriodStart.Equal(receivedAt) {
+		t.Errorf("subscription starts at %v, want when the delivery was received, %v", sub.CurrentPeriodStart, receivedAt)
+	}
+	if code := postPolkaWebhook(t, chirpy.URL, webhook.Sign(cfg.polkaWebhookSecret, time.Now(), body), body); code != http.StatusNoContent {
+		t.Errorf("redelivery status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	// A delivery without an event ID, as API key deliveries may be, that
+	// was applied before the server stopped isn't applied again on replay.
+	cfg.polkaWebhookSecret = ""
+	body, _ = json.Marshal(map[string]any{
+		"event": "user.renewed",
+		"data":  map[string]string{"user_id": user.Id.String()},
+	})
+	stored, err = cfg.recordWebhookEvent(context.Background(), webhookSourcePolka, http.Header{}, body)
+	if err != nil {
+		t.Fatalf("Couldn't record webhook event: %v", err)
+	}
+	if outcome := cfg.processPolkaEvent(context.Background(), stored.ID, body, stored.CreatedAt); outcome.status != webhookEventProcessed {
+		t.Fatalf("processing renewal = %s (%v), want processed", outcome.status, outcome.err)
+	}
+	renewed, _ := cfg.db.GetLatestSubscription(context.Background(), user.Id)
+	serveAdmin(t, cfg.handlerAdminReplayWebhookEvent(), http.MethodPost, "/", map[string]string{"eventID": stored.ID.String()}, &replayed)
+	if replayed.Status != webhookEventDuplicate {
+		t.Errorf("replayed renewal = %s, want %s", replayed.Status, webhookEventDuplicate)
+	}
+	if sub, _ := cfg.db.GetLatestSubscription(context.Background(), user.Id); !sub.CurrentPeriodEnd.Equal(renewed.CurrentPeriodEnd) {
+		t.Errorf("period ends %v after replay, want %v", sub.CurrentPeriodEnd, renewed.CurrentPeriodEnd)
+	}
+}